@@ -3,6 +3,8 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"monkey/token"
 )
@@ -51,9 +53,11 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern  // set instead of Name by let [a, b] = ... and let {a} = ...
+	Type    TypeExpr // nil unless annotated
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -61,7 +65,14 @@ func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -89,6 +100,19 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// YieldStatement hands a value to the consumer of a generator and suspends
+// the function until the next one is asked for.
+type YieldStatement struct {
+	Token token.Token // the 'yield' token
+	Value Expression
+}
+
+func (ys *YieldStatement) statementNode()       {}
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Literal }
+func (ys *YieldStatement) String() string {
+	return ys.TokenLiteral() + " " + ys.Value.String() + ";"
+}
+
 type ExpressionStatement struct {
 	Token      token.Token // 1st token of the expression
 	Expression Expression
@@ -103,6 +127,61 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
+// StructStatement declares a record type, e.g.
+// struct Point { x, y, fn norm(p) { p.x * p.x + p.y * p.y } }.
+type StructStatement struct {
+	Token   token.Token // the token.STRUCT token
+	Name    *Identifier
+	Fields  []*Identifier
+	Methods []*Method
+	End     token.Token // the '}' token
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	members := []string{}
+	for _, f := range ss.Fields {
+		members = append(members, f.String())
+	}
+	for _, m := range ss.Methods {
+		members = append(members, m.String())
+	}
+	return ss.TokenLiteral() + " " + ss.Name.String() + " { " + strings.Join(members, ", ") + " }"
+}
+
+// ForStatement runs Body once for each element of Iterable, e.g.
+// for (k, v in hash) { print(k, v) }. Key is nil with a single variable,
+// which is bound to the keys of hashes and the elements of everything else.
+type ForStatement struct {
+	Token    token.Token // the 'for' token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	vars := fs.Value.String()
+	if fs.Key != nil {
+		vars = fs.Key.String() + ", " + vars
+	}
+	return fs.TokenLiteral() + " (" + vars + " in " + fs.Iterable.String() + ") " + fs.Body.String()
+}
+
+// Method is a function declared in a struct. Its first parameter is the
+// record it's called on.
+type Method struct {
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (m *Method) String() string {
+	return m.Function.TokenLiteral() + " " + m.Name.String() + strings.TrimPrefix(m.Function.String(), m.Function.TokenLiteral())
+}
+
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
@@ -121,9 +200,34 @@ func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// InterpolatedString is a string with embedded expressions, e.g.
+// "total: ${a + b}". Parts holds the text as *StringLiteral and the embedded
+// expressions in source order.
+type InterpolatedString struct {
+	Token token.Token // the token.TEMPLATE token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+	out.WriteString(`"`)
+	for _, p := range is.Parts {
+		if sl, ok := p.(*StringLiteral); ok {
+			out.WriteString(sl.Value)
+		} else {
+			out.WriteString("${" + p.String() + "}")
+		}
+	}
+	out.WriteString(`"`)
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
+	End      token.Token // the ']' token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
@@ -153,11 +257,70 @@ func (ie *IndexExpression) String() string {
 	return fmt.Sprintf("(%s[%s])", ie.Left, ie.Index)
 }
 
+// FieldExpression is `left.field`, the field or method of a record.
+type FieldExpression struct {
+	Token token.Token // The . token
+	Left  Expression
+	Field *Identifier
+}
+
+func (fe *FieldExpression) expressionNode()      {}
+func (fe *FieldExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *FieldExpression) String() string {
+	return fmt.Sprintf("(%s.%s)", fe.Left, fe.Field)
+}
+
+// SliceExpression is `left[start:end]`, Start and End are nil when omitted.
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(" + se.Left.String() + "[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token  token.Token // 'fn' token
 	Params []*Identifier
 	Body   *BlockStatement
 	Name   string
+
+	// ParamTypes has the annotation of each parameter, nil for those
+	// without one. It may be empty if none are annotated.
+	ParamTypes []TypeExpr
+	ReturnType TypeExpr
+
+	// ParamPatterns has the pattern each destructured parameter is
+	// destructured with, nil for plain names. It may be empty if none are
+	// destructured. The argument is bound to the parameter first, which is
+	// named after the pattern so it can't clash with the program's names.
+	ParamPatterns []Pattern
+
+	// Defaults has the default value of each parameter, nil for those
+	// without one. It may be empty if none have one. Only the parameters
+	// following the required ones have one.
+	Defaults []Expression
+	// Variadic is set if the last parameter collects the arguments beyond
+	// the others into an array, as in fn(a, ...rest).
+	Variadic bool
+	// Generator is set if the body yields, calling the function then
+	// returns a generator running the body lazily.
+	Generator bool
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -171,17 +334,67 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	for i, p := range fl.Params {
+		if fl.Variadic && i == len(fl.Params)-1 {
+			out.WriteString("...")
+		}
 		out.WriteString(p.String())
+		if typ := fl.ParamType(i); typ != nil {
+			out.WriteString(": " + typ.String())
+		}
+		if def := fl.ParamDefault(i); def != nil {
+			out.WriteString(" = " + def.String())
+		}
 		if i < len(fl.Params)-1 {
 			out.WriteString(", ")
 		}
 	}
 
 	out.WriteString(")")
+	if fl.ReturnType != nil {
+		out.WriteString(" -> " + fl.ReturnType.String())
+	}
 	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
+// ParamType returns the annotation of the i-th parameter, or nil.
+func (fl *FunctionLiteral) ParamType(i int) TypeExpr {
+	if i < len(fl.ParamTypes) {
+		return fl.ParamTypes[i]
+	}
+	return nil
+}
+
+// ParamDefault returns the default value of the i-th parameter, or nil.
+func (fl *FunctionLiteral) ParamDefault(i int) Expression {
+	if i < len(fl.Defaults) {
+		return fl.Defaults[i]
+	}
+	return nil
+}
+
+// ParamPattern returns the pattern the i-th parameter is destructured
+// with, or nil.
+func (fl *FunctionLiteral) ParamPattern(i int) Pattern {
+	if i < len(fl.ParamPatterns) {
+		return fl.ParamPatterns[i]
+	}
+	return nil
+}
+
+// ImportExpression evaluates to the namespace of another source file, e.g.
+// import("utils.mk").
+type ImportExpression struct {
+	Token token.Token // The 'import' token
+	Path  *StringLiteral
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + "(" + strconv.Quote(ie.Path.Value) + ")"
+}
+
 type MacroLiteral struct {
 	Token  token.Token // The 'macro' token
 	Params []*Identifier
@@ -264,17 +477,199 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// MatchExpression evaluates to the body of the first arm whose pattern
+// matches the value and whose guard holds, or to null if there's none.
+type MatchExpression struct {
+	Token token.Token // the 'match' token
+	Value Expression
+	Arms  []*MatchArm
+	End   token.Token // the '}' token
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	arms := make([]string, len(me.Arms))
+	for i, arm := range me.Arms {
+		arms[i] = arm.String()
+	}
+	return "match (" + me.Value.String() + ") { " + strings.Join(arms, ", ") + " }"
+}
+
+// MatchArm is `pattern if guard => body`, Guard is nil if there's none.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+}
+
+func (ma *MatchArm) String() string {
+	out := ma.Pattern.String()
+	if ma.Guard != nil {
+		out += " if " + ma.Guard.String()
+	}
+	return out + " => " + ma.Body.String()
+}
+
+// Pattern is what the arms of a match expression test values against.
+// Names within patterns are bound like variables defined by let.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern `_` matches every value.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// LiteralPattern matches values equal to an integer, string or boolean
+// literal. Negative integers are prefix expressions.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string {
+	switch v := lp.Value.(type) {
+	case *StringLiteral:
+		return strconv.Quote(v.Value)
+	case *PrefixExpression:
+		return v.Operator + v.Right.String()
+	}
+	return lp.Value.String()
+}
+
+// BindingPattern matches every value and binds it to Name.
+type BindingPattern struct {
+	Name *Identifier
+}
+
+func (bp *BindingPattern) patternNode()         {}
+func (bp *BindingPattern) TokenLiteral() string { return bp.Name.TokenLiteral() }
+func (bp *BindingPattern) String() string       { return bp.Name.String() }
+
+// ArrayPattern matches arrays whose elements match Elements. Without Rest
+// the array must have as many elements as there are patterns, otherwise it
+// may have more, which Rest is bound to.
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := make([]string, len(ap.Elements), len(ap.Elements)+1)
+	for i, el := range ap.Elements {
+		elements[i] = el.String()
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern matches hashes that have each of the keys, with values
+// matching the corresponding pattern. Other keys are ignored. A name on its
+// own, as in {name}, is short for {"name": name}.
+type HashPattern struct {
+	Token  token.Token // the '{' token
+	Keys   []*LiteralPattern
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := make([]string, len(hp.Keys))
+	for i, key := range hp.Keys {
+		if key.Token.Type == token.IDENT {
+			pairs[i] = hp.Values[i].String()
+			continue
+		}
+		pairs[i] = key.String() + ": " + hp.Values[i].String()
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// PatternNames returns the names a pattern binds, in order.
+func PatternNames(pattern Pattern) []*Identifier {
+	var names []*Identifier
+	switch pattern := pattern.(type) {
+	case *BindingPattern:
+		names = append(names, pattern.Name)
+	case *ArrayPattern:
+		for _, el := range pattern.Elements {
+			names = append(names, PatternNames(el)...)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			names = append(names, pattern.Rest)
+		}
+	case *HashPattern:
+		for _, v := range pattern.Values {
+			names = append(names, PatternNames(v)...)
+		}
+	}
+	return names
+}
+
+// TopLevelNames returns the names the top-level lets and structs of a
+// program define, in order of definition. They're what a module exports.
+func TopLevelNames(program *Program) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, s := range program.Statements {
+		var defined []*Identifier
+		switch s := s.(type) {
+		case *LetStatement:
+			defined = []*Identifier{s.Name}
+			if s.Pattern != nil {
+				defined = PatternNames(s.Pattern)
+			}
+		case *StructStatement:
+			defined = []*Identifier{s.Name}
+		}
+		for _, name := range defined {
+			if !seen[name.Value] {
+				seen[name.Value] = true
+				names = append(names, name.Value)
+			}
+		}
+	}
+	return names
+}
+
+// SpreadExpression passes the elements of an array as separate arguments
+// of a call, as in f(a, ...rest).
+type SpreadExpression struct {
+	Token token.Token // the '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 type CallExpression struct {
 	Token     token.Token // '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	End       token.Token // the ')' token
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
-	out.WriteString(ce.Function.TokenLiteral())
+	out.WriteString(ce.Function.String())
 	out.WriteString("(")
 	for i, v := range ce.Arguments {
 		out.WriteString(v.String())
@@ -287,8 +682,9 @@ func (ce *CallExpression) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // the '{' token
 	Statements []Statement
+	End        token.Token // the '}' token, or EOF if it's missing
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -306,6 +702,8 @@ func (bs *BlockStatement) String() string {
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // keys of Pairs in source order
+	End   token.Token  // the '}' token
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -313,11 +711,76 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("{")
-	for key, value := range hl.Pairs {
-		out.WriteString(key.String() + ":" + value.String())
-		out.WriteString(", ")
+	for i, key := range hl.Keys {
+		out.WriteString(key.String() + ": " + hl.Pairs[key].String())
+		if i < len(hl.Keys)-1 {
+			out.WriteString(", ")
+		}
 	}
-	// out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString("}")
 	return out.String()
 }
+
+// TypeExpr is a type annotation, e.g. the int of `let x: int = 1`. They're
+// only looked at by the type checker, not by the engines.
+type TypeExpr interface {
+	Node
+	typeNode()
+}
+
+// NamedType is a type referred to by its name, like int or string.
+type NamedType struct {
+	Token token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string       { return nt.Name }
+
+// ArrayType is the type of arrays of elements of one type, e.g. [int].
+type ArrayType struct {
+	Token   token.Token // the '[' token
+	Element TypeExpr
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+// HashType is the type of hashes mapping keys of one type to values of
+// another, e.g. {string: int}.
+type HashType struct {
+	Token token.Token // the '{' token
+	Key   TypeExpr
+	Value TypeExpr
+}
+
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+// FunctionType is the type of functions, e.g. fn(int, int) -> bool. Return
+// is nil if the result isn't annotated.
+type FunctionType struct {
+	Token  token.Token // the 'fn' token
+	Params []TypeExpr
+	Return TypeExpr
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string {
+	params := make([]string, len(ft.Params))
+	for i, p := range ft.Params {
+		params[i] = p.String()
+	}
+
+	out := "fn(" + strings.Join(params, ", ") + ")"
+	if ft.Return != nil {
+		out += " -> " + ft.Return.String()
+	}
+	return out
+}
@@ -24,6 +24,18 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		node.Left, _ = Modify(node.Left, modifier).(Expression)
 		node.Index, _ = Modify(node.Index, modifier).(Expression)
 
+	case *FieldExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+
+	case *SliceExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		if node.Start != nil {
+			node.Start, _ = Modify(node.Start, modifier).(Expression)
+		}
+		if node.End != nil {
+			node.End, _ = Modify(node.End, modifier).(Expression)
+		}
+
 	case *IfExpression:
 		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
 		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
@@ -31,6 +43,18 @@ func Modify(node Node, modifier ModifierFunc) Node {
 			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
 		}
 
+	case *SpreadExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *MatchExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+		for _, arm := range node.Arms {
+			if arm.Guard != nil {
+				arm.Guard, _ = Modify(arm.Guard, modifier).(Expression)
+			}
+			arm.Body, _ = Modify(arm.Body, modifier).(Expression)
+		}
+
 	case *BlockStatement:
 		for i := range node.Statements {
 			node.Statements[i], _ = Modify(node.Statements[i], modifier).(Statement)
@@ -39,13 +63,30 @@ func Modify(node Node, modifier ModifierFunc) Node {
 	case *ReturnStatement:
 		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
 
+	case *YieldStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
 	case *LetStatement:
 		node.Value, _ = Modify(node.Value, modifier).(Expression)
 
+	case *ForStatement:
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *StructStatement:
+		for _, m := range node.Methods {
+			m.Function, _ = Modify(m.Function, modifier).(*FunctionLiteral)
+		}
+
 	case *FunctionLiteral:
 		for i := range node.Params {
 			node.Params[i], _ = Modify(node.Params[i], modifier).(*Identifier)
 		}
+		for i := range node.Defaults {
+			if node.Defaults[i] != nil {
+				node.Defaults[i], _ = Modify(node.Defaults[i], modifier).(Expression)
+			}
+		}
 		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 
 	case *ArrayLiteral:
@@ -53,14 +94,22 @@ func Modify(node Node, modifier ModifierFunc) Node {
 			node.Elements[i], _ = Modify(node.Elements[i], modifier).(Expression)
 		}
 
+	case *InterpolatedString:
+		for i := range node.Parts {
+			node.Parts[i], _ = Modify(node.Parts[i], modifier).(Expression)
+		}
+
 	case *HashLiteral:
 		newPairs := make(map[Expression]Expression)
-		for key, val := range node.Pairs {
+		newKeys := make([]Expression, 0, len(node.Keys))
+		for _, key := range node.Keys {
 			newKey, _ := Modify(key, modifier).(Expression)
-			newVal, _ := Modify(val, modifier).(Expression)
+			newVal, _ := Modify(node.Pairs[key], modifier).(Expression)
 			newPairs[newKey] = newVal
+			newKeys = append(newKeys, newKey)
 		}
 		node.Pairs = newPairs
+		node.Keys = newKeys
 
 	}
 
@@ -128,15 +128,21 @@ func TestModify(t *testing.T) {
 		}
 	}
 
+	k1, k2 := one(), one()
 	hashLiteral := &HashLiteral{
 		Pairs: map[Expression]Expression{
-			one(): one(),
-			one(): one(),
+			k1: one(),
+			k2: one(),
 		},
+		Keys: []Expression{k1, k2},
 	}
 
 	Modify(hashLiteral, turnOneIntoTwo)
 
+	if len(hashLiteral.Pairs) != 2 || len(hashLiteral.Keys) != 2 {
+		t.Fatalf("wrong number of pairs after Modify. got=%d pairs, %d keys", len(hashLiteral.Pairs), len(hashLiteral.Keys))
+	}
+
 	for key, val := range hashLiteral.Pairs {
 		key, _ := key.(*IntegerLiteral)
 		if key.Value != 2 {
@@ -46,6 +46,8 @@ const (
 	OpArray
 	OpHash
 	OpIndex
+	OpSlice
+	OpInterpolate
 
 	OpCall
 	OpReturnValue
@@ -53,6 +55,43 @@ const (
 	OpGetBuiltin
 	OpClosure
 	OpCurrentClosure
+	OpImport
+
+	// OpMatchArray pushes whether the popped value is an array with as
+	// many elements as its first operand, or at least as many if the
+	// second operand is 1.
+	OpMatchArray
+	// OpMatchHash pops as many keys as its operand and a value below them,
+	// and pushes whether the value is a hash with all of the keys.
+	OpMatchHash
+	// OpDestructureArray pops a value and pushes it as an array, for an
+	// array pattern with as many elements as its first operand and a rest
+	// if the second operand is 1. It fails unless the value is an array or
+	// a generator.
+	OpDestructureArray
+	// OpDestructureHash pops a value and fails unless it's a hash.
+	OpDestructureHash
+
+	// OpCallSpread calls the function below as many arrays as its operand
+	// with their elements as the arguments.
+	OpCallSpread
+	// OpStruct pushes a copy of the record type constant, with as many
+	// pairs of method names and closures as its second operand popped as
+	// its methods.
+	OpStruct
+	// OpField pushes the field of the popped record named by the string
+	// constant.
+	OpField
+	// OpIter pops a value and pushes an iterator over it, for a loop with
+	// as many variables as its operand.
+	OpIter
+	// OpIterNext pops an iterator and jumps to its first operand if it's
+	// done. Otherwise it pushes the value of the next element, preceded by
+	// its key if the second operand is 2.
+	OpIterNext
+	// OpYield pops a value and suspends the generator running in the current
+	// frame, handing the value to whoever resumed it.
+	OpYield
 )
 
 var definitions = map[Opcode]*Definition{
@@ -79,6 +118,8 @@ var definitions = map[Opcode]*Definition{
 	OpArray:          {"OpArray", []int{2}},
 	OpHash:           {"OpHash", []int{2}},
 	OpIndex:          {"OpEqual", []int{}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpInterpolate:    {"OpInterpolate", []int{2}},
 	OpCall:           {"OpCall", []int{1}},
 	OpReturnValue:    {"OpReturnValue", []int{}},
 	OpReturn:         {"OpReturn", []int{}},
@@ -86,6 +127,18 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpImport:         {"OpImport", []int{2}},
+	OpMatchArray:     {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:      {"OpMatchHash", []int{2}},
+
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1}},
+	OpDestructureHash:  {"OpDestructureHash", []int{}},
+	OpCallSpread:       {"OpCallSpread", []int{1}},
+	OpStruct:           {"OpStruct", []int{2, 1}},
+	OpField:            {"OpField", []int{2}},
+	OpIter:             {"OpIter", []int{1}},
+	OpIterNext:         {"OpIterNext", []int{2, 1}},
+	OpYield:            {"OpYield", []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -14,6 +14,7 @@ func TestMake(t *testing.T) {
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpMatchArray, []int{2, 1}, []byte{byte(OpMatchArray), 0, 2, 1}},
 	}
 	for _, tt := range tests {
 		instruction := Make(tt.op, tt.operands...)
@@ -2,11 +2,11 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
 
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
+	"monkey/token"
 )
 
 type Compiler struct {
@@ -14,6 +14,28 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIndex  int
+
+	file    string // source file being compiled, empty for the REPL
+	modules *Modules
+
+	matchDepth int // nesting of match expressions, names their subjects
+	loopDepth  int // nesting of for loops, names their iterators
+	arrayDepth int // nesting of array patterns destructured, names their arrays
+}
+
+// Error is a compile error, positioned at the token it was found at.
+type Error struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func errorAt(tok token.Token, format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Line: tok.Line, Column: tok.Column}
 }
 
 type CompilationScope struct {
@@ -43,6 +65,7 @@ func NewWithState(st *SymbolTable, constants []object.Object) *Compiler {
 	return &Compiler{
 		symbolTable: st,
 		constants:   constants,
+		scopes:      []CompilationScope{{}},
 	}
 }
 
@@ -57,6 +80,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return c.compileDestructuringLet(node)
+		}
+
 		// define symbol as a first thing to support recursive closures
 		symbol := c.symbolTable.Define(node.Name.Value)
 		err := c.Compile(node.Value)
@@ -70,10 +97,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpSetLocal, symbol.Index)
 		}
 
+	case *ast.StructStatement:
+		if err := c.compileStruct(node); err != nil {
+			return err
+		}
+
+	case *ast.ForStatement:
+		if err := c.compileFor(node); err != nil {
+			return err
+		}
+
 	case *ast.Identifier:
 		sym, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return errorAt(node.Token, "undefined variable %s", node.Value)
 		}
 
 		c.loadSymbol(sym)
@@ -156,10 +193,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		// remove last OpPop so the block statement evaluates to something
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastInstruction()
-		}
+		c.blockValue()
 
 		// emit an `OpJump` with a bogus value
 		jumpPos := c.emit(code.OpJump, 9999)
@@ -175,15 +209,17 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			// remove last OpPop so the block statement evaluates to something
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastInstruction()
-			}
+			c.blockValue()
 		}
 
 		afterAlternativePos := len(c.curInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 
+	case *ast.MatchExpression:
+		if err := c.compileMatch(node); err != nil {
+			return err
+		}
+
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -193,14 +229,41 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.FunctionLiteral:
+		// defaults are evaluated in the enclosing scope when the closure is
+		// created, OpClosure takes them off the stack below the free variables
+		numDefaults := 0
+		for _, d := range node.Defaults {
+			if d == nil {
+				continue
+			}
+			if err := c.Compile(d); err != nil {
+				return err
+			}
+			numDefaults++
+		}
+
 		c.enterScope()
 
 		if node.Name != "" {
 			c.symbolTable.DefineFunctionName(node.Name)
 		}
 
-		for _, p := range node.Params {
-			c.symbolTable.Define(p.Value)
+		params := make([]Symbol, len(node.Params))
+		for i, p := range node.Params {
+			params[i] = c.symbolTable.Define(p.Value)
+		}
+		for i, pattern := range node.ParamPatterns {
+			if pattern == nil {
+				continue
+			}
+			param := params[i]
+			err := c.compileDestructuring(pattern, func() error {
+				c.loadSymbol(param)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
 		}
 
 		err := c.Compile(node.Body)
@@ -230,6 +293,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions: instructions,
 			NumLocals:    numLocals,
 			NumParams:    len(node.Params),
+			NumDefaults:  numDefaults,
+			Variadic:     node.Variadic,
+			Generator:    node.Generator,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
@@ -242,12 +308,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpReturnValue)
 
+	case *ast.YieldStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpYield)
+
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
 		if err != nil {
 			return err
 		}
 
+		if hasSpread(node.Arguments) {
+			return c.compileSpreadArguments(node.Arguments)
+		}
+
 		for _, a := range node.Arguments {
 			err := c.Compile(a)
 			if err != nil {
@@ -264,6 +340,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
 
+	case *ast.InterpolatedString:
+		for _, p := range node.Parts {
+			if err := c.Compile(p); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
 	case *ast.ArrayLiteral:
 		for _, el := range node.Elements {
 			if err := c.Compile(el); err != nil {
@@ -273,14 +357,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpArray, len(node.Elements))
 
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-		for _, k := range keys {
+		for _, k := range node.Keys {
 			if err := c.Compile(k); err != nil {
 				return err
 			}
@@ -299,6 +376,33 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpIndex)
 
+	case *ast.FieldExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpField, c.addConstant(&object.String{Value: node.Field.Value}))
+
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			if err := c.Compile(bound); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+
+	case *ast.ImportExpression:
+		if err := c.compileImport(node); err != nil {
+			// errors in the imported file are reported at the import
+			return errorAt(node.Token, "%s", err)
+		}
+
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -310,6 +414,48 @@ func (c *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+func hasSpread(args []ast.Expression) bool {
+	for _, a := range args {
+		if _, ok := a.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadArguments passes the arguments of a call as arrays, the
+// spread ones as they are and runs of the others gathered into one. The
+// function is already on the stack.
+func (c *Compiler) compileSpreadArguments(args []ast.Expression) error {
+	arrays, pending := 0, 0
+	for _, a := range args {
+		spread, ok := a.(*ast.SpreadExpression)
+		if !ok {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+			pending++
+			continue
+		}
+
+		if pending > 0 {
+			c.emit(code.OpArray, pending)
+			arrays, pending = arrays+1, 0
+		}
+		if err := c.Compile(spread.Value); err != nil {
+			return err
+		}
+		arrays++
+	}
+	if pending > 0 {
+		c.emit(code.OpArray, pending)
+		arrays++
+	}
+
+	c.emit(code.OpCallSpread, arrays)
+	return nil
+}
+
 func (c *Compiler) curInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
 }
@@ -370,6 +516,17 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 	}
 }
 
+// blockValue leaves the value of the block just compiled on the stack: that
+// of its last expression, or null if it ends with another statement such as
+// a let or a for loop.
+func (c *Compiler) blockValue() {
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastInstruction()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
 func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
 }
@@ -384,6 +541,16 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
+// enterBlock starts a block scope, see NewBlockSymbolTable, which lasts
+// until leaveBlock.
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
 func (c *Compiler) leaveScopeAndReturnInstructions() code.Instructions {
 	instructions := c.curInstructions()
 	c.scopes = c.scopes[:len(c.scopes)-1]
@@ -396,11 +563,13 @@ func (c *Compiler) leaveScopeAndReturnInstructions() code.Instructions {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	GlobalNames  []string // the names of the globals by index
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.curInstructions(),
 		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.GlobalNames(),
 	}
 }
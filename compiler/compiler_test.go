@@ -2,6 +2,9 @@ package compiler
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"monkey/code"
@@ -537,6 +540,20 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `"a${1}b${2 + 3}"`,
+			expectedConstants: []interface{}{"a", 1, "b", 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpInterpolate, 4),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -662,6 +679,293 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2][1:2]",
+			expectedConstants: []interface{}{1, 2, 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[][:]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let [a, ...r] = [1];",
+			expectedConstants: []interface{}{1, 0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpDestructureArray, 1, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpSetGlobal, 3),
+			},
+		},
+		{
+			input: "fn({k}) { k }",
+			expectedConstants: []interface{}{
+				"k",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpDestructureHash),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a, b = 10) { b }",
+			expectedConstants: []interface{}{
+				10,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let f = 1; f(1, ...[2], 3);",
+			expectedConstants: []interface{}{1, 1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpCallSpread, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "struct P { x, fn get(p) { p.x } } P(1).x",
+			expectedConstants: []interface{}{
+				"get",
+				"x",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpField, 1),
+					code.Make(code.OpReturnValue),
+				},
+				&object.RecordType{Name: "P", Fields: []string{"x"}},
+				1,
+				"x",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpStruct, 3, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpField, 5),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "for (k, v in [1]) { v }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter, 2),
+				// 0008
+				code.Make(code.OpSetGlobal, 0),
+				// 0011
+				code.Make(code.OpGetGlobal, 0),
+				// 0014
+				code.Make(code.OpIterNext, 31, 2),
+				// 0018
+				code.Make(code.OpSetGlobal, 2),
+				// 0021
+				code.Make(code.OpSetGlobal, 1),
+				// 0024
+				code.Make(code.OpGetGlobal, 2),
+				// 0027
+				code.Make(code.OpPop),
+				// 0028
+				code.Make(code.OpJump, 11),
+				// 0031
+				code.Make(code.OpNull),
+				// 0032
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(xs) { for (x in xs) { x } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpIter, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpIterNext, 20, 1),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpPop),
+					code.Make(code.OpJump, 6),
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { yield 1; yield 2; }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpYield),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpYield),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	compiler := New()
+	if err := compiler.Compile(parser.New(lexer.New("fn() { yield 1; }; fn() { 1 }")).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	constants := compiler.Bytecode().Constants
+	if fn := constants[1].(*object.CompiledFunction); !fn.Generator {
+		t.Errorf("function with yield not marked as generator")
+	}
+	if fn := constants[3].(*object.CompiledFunction); fn.Generator {
+		t.Errorf("function without yield marked as generator")
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "match (1) { 2 if true => 3, x => x }",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpEqual),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 26),
+				// 0016
+				code.Make(code.OpTrue),
+				// 0017
+				code.Make(code.OpJumpNotTruthy, 26),
+				// 0020
+				code.Make(code.OpConstant, 2),
+				// 0023
+				code.Make(code.OpJump, 39),
+				// 0026
+				code.Make(code.OpGetGlobal, 0),
+				// 0029
+				code.Make(code.OpSetGlobal, 1),
+				// 0032
+				code.Make(code.OpGetGlobal, 1),
+				// 0035
+				code.Make(code.OpJump, 39),
+				// 0038
+				code.Make(code.OpNull),
+				// 0039
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -980,6 +1284,15 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
 			}
+
+		case *object.RecordType:
+			rt, ok := actual[i].(*object.RecordType)
+			if !ok {
+				return fmt.Errorf("constant %d - not a record type: %T", i, actual[i])
+			}
+			if rt.Name != constant.Name || strings.Join(rt.Fields, ",") != strings.Join(constant.Fields, ",") {
+				return fmt.Errorf("constant %d - wrong record type. got=%s %v, want=%s %v", i, rt.Name, rt.Fields, constant.Name, constant.Fields)
+			}
 		}
 
 	}
@@ -1007,3 +1320,96 @@ func testStringObject(expected string, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib", "a.mk"), `let x = 1; let f = fn() { x };`)
+	main := filepath.Join(dir, "main.mk")
+
+	input := `let a = 5; import("lib/a.mk"); let b = import("./lib/a.mk");`
+	compiler := NewForFile(main)
+	if err := compiler.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	// globals of the module are allocated after those of the importer
+	// defined so far, the module is compiled only once
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpImport, 5),
+		code.Make(code.OpPop),
+		code.Make(code.OpImport, 5),
+		code.Make(code.OpSetGlobal, 3),
+	}
+	expectedConstants := []interface{}{
+		5,
+		1,
+		[]code.Instructions{
+			code.Make(code.OpGetGlobal, 1),
+			code.Make(code.OpReturnValue),
+		},
+		"x",
+		"f",
+		[]code.Instructions{
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpSetGlobal, 1),
+			code.Make(code.OpClosure, 2, 0),
+			code.Make(code.OpSetGlobal, 2),
+			code.Make(code.OpConstant, 3),
+			code.Make(code.OpGetGlobal, 1),
+			code.Make(code.OpConstant, 4),
+			code.Make(code.OpGetGlobal, 2),
+			code.Make(code.OpHash, 4),
+			code.Make(code.OpReturnValue),
+		},
+	}
+
+	if err := testInstructions(expectedInstructions, bytecode.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	if err := testConstants(t, expectedConstants, bytecode.Constants); err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.mk"), filepath.Join(dir, "b.mk")
+	writeFile(t, a, `let b = import("b.mk");`)
+	writeFile(t, b, `let a = import("a.mk");`)
+	writeFile(t, filepath.Join(dir, "private.mk"), `secret`)
+	writeFile(t, filepath.Join(dir, "broken.mk"), `let = 1;`)
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`import("a.mk")`, fmt.Sprintf("%s: %s: circular import: %s -> %s -> %s", a, b, a, b, a)},
+		{`import("missing.mk")`, fmt.Sprintf(`cannot import "missing.mk": open %s: no such file or directory`, filepath.Join(dir, "missing.mk"))},
+		{`let secret = 1; import("private.mk")`, filepath.Join(dir, "private.mk") + ": undefined variable secret"},
+		{`import("broken.mk")`, filepath.Join(dir, "broken.mk") + ": expected next token to be IDENT, got ="},
+	}
+
+	for _, tt := range tests {
+		compiler := NewForFile(filepath.Join(dir, "main.mk"))
+		err := compiler.Compile(parser.New(lexer.New(tt.input)).ParseProgram())
+		if err == nil {
+			t.Fatalf("expected compiler error for %q, got none", tt.input)
+		}
+		if err.Error() != tt.expectedError {
+			t.Errorf("wrong error for %q.\nwant=%q\ngot =%q", tt.input, tt.expectedError, err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
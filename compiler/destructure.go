@@ -0,0 +1,108 @@
+package compiler
+
+import (
+	"fmt"
+
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// compileDestructuringLet stores the value in a hidden variable, which the
+// parts bound to the names of the pattern are taken from.
+func (c *Compiler) compileDestructuringLet(ls *ast.LetStatement) error {
+	if err := c.Compile(ls.Value); err != nil {
+		return err
+	}
+
+	value := c.symbolTable.DefineHidden("@let")
+	c.storeSymbol(value)
+
+	return c.compileDestructuring(ls.Pattern, func() error {
+		c.loadSymbol(value)
+		return nil
+	})
+}
+
+// compileDestructuring binds the names of a let or parameter pattern to the
+// parts of the value load pushes. Missing elements and keys are null, as
+// they're taken apart by indexing. Array patterns take generators apart too,
+// see object.DestructureArray.
+func (c *Compiler) compileDestructuring(pattern ast.Pattern, load func() error) error {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		c.storeSymbol(c.symbolTable.Define(pattern.Name.Value))
+
+	case *ast.ArrayPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		rest := 0
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest = 1
+		}
+		c.emit(code.OpDestructureArray, len(pattern.Elements), rest)
+
+		// generators are turned into arrays, kept to take them apart
+		array := c.symbolTable.DefineHidden(fmt.Sprintf("@array%d", c.arrayDepth))
+		c.storeSymbol(array)
+		c.arrayDepth++
+		defer func() { c.arrayDepth-- }()
+		load = func() error {
+			c.loadSymbol(array)
+			return nil
+		}
+
+		for i, el := range pattern.Elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			err := c.compileDestructuring(el, func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			if err := load(); err != nil {
+				return err
+			}
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(len(pattern.Elements))}))
+			c.emit(code.OpNull)
+			c.emit(code.OpSlice)
+			c.storeSymbol(c.symbolTable.Define(pattern.Rest.Value))
+		}
+
+	case *ast.HashPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		c.emit(code.OpDestructureHash)
+
+		for i, key := range pattern.Keys {
+			key := key
+			err := c.compileDestructuring(pattern.Values[i], func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				if err := c.Compile(key.Value); err != nil {
+					return err
+				}
+				c.emit(code.OpIndex)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"fmt"
+
+	"monkey/ast"
+	"monkey/code"
+)
+
+// compileFor stores an iterator over the iterable in a hidden variable. Each
+// pass of the loop takes the next element from it and binds the loop
+// variables, OpIterNext jumps past the body once there are no elements left.
+// The loop variables and the names the body defines can only be seen in the
+// body, and the loop leaves null behind as its value, like in the evaluator.
+func (c *Compiler) compileFor(fs *ast.ForStatement) error {
+	if err := c.Compile(fs.Iterable); err != nil {
+		return err
+	}
+
+	vars := 1
+	if fs.Key != nil {
+		vars = 2
+	}
+	c.emit(code.OpIter, vars)
+
+	iterator := c.symbolTable.DefineHidden(fmt.Sprintf("@iter%d", c.loopDepth))
+	c.storeSymbol(iterator)
+	c.loopDepth++
+	defer func() { c.loopDepth-- }()
+
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	var key Symbol
+	if fs.Key != nil {
+		key = c.symbolTable.Define(fs.Key.Value)
+	}
+	value := c.symbolTable.Define(fs.Value.Value)
+
+	start := len(c.curInstructions())
+	c.loadSymbol(iterator)
+	next := c.emit(code.OpIterNext, 9999, vars)
+	c.storeSymbol(value)
+	if fs.Key != nil {
+		c.storeSymbol(key)
+	}
+
+	if err := c.Compile(fs.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	c.replaceInstruction(next, code.Make(code.OpIterNext, len(c.curInstructions()), vars))
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+	return nil
+}
@@ -0,0 +1,180 @@
+package compiler
+
+import (
+	"fmt"
+
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// compileMatch stores the matched value in a hidden variable and tests the
+// arms against it in order. Every test of an arm is followed by a jump to
+// the next arm taken if it fails, the arm that matches leaves the value of
+// its body and jumps past the others.
+func (c *Compiler) compileMatch(me *ast.MatchExpression) error {
+	if err := c.Compile(me.Value); err != nil {
+		return err
+	}
+
+	subject := c.symbolTable.DefineHidden(fmt.Sprintf("@match%d", c.matchDepth))
+	c.storeSymbol(subject)
+	c.matchDepth++
+	defer func() { c.matchDepth-- }()
+
+	var ends []int
+	for _, arm := range me.Arms {
+		end, err := c.compileArm(arm, subject)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, end)
+	}
+
+	// no arm matched
+	c.emit(code.OpNull)
+
+	for _, pos := range ends {
+		c.changeOperand(pos, len(c.curInstructions()))
+	}
+	return nil
+}
+
+// compileArm compiles an arm in a block of its own, so the names its pattern
+// binds can only be seen by its guard and body. It returns the position of
+// the jump past the other arms.
+func (c *Compiler) compileArm(arm *ast.MatchArm, subject Symbol) (int, error) {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	fails, err := c.compilePattern(arm.Pattern, func() error {
+		c.loadSymbol(subject)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if arm.Guard != nil {
+		if err := c.Compile(arm.Guard); err != nil {
+			return 0, err
+		}
+		fails = append(fails, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	if err := c.Compile(arm.Body); err != nil {
+		return 0, err
+	}
+	end := c.emit(code.OpJump, 9999)
+
+	for _, pos := range fails {
+		c.changeOperand(pos, len(c.curInstructions()))
+	}
+	return end, nil
+}
+
+// compilePattern emits the tests of a pattern against the value load
+// pushes, binding the names in it as it goes. It returns the positions of
+// the jumps taken if a test fails.
+func (c *Compiler) compilePattern(pattern ast.Pattern, load func() error) ([]int, error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil, nil
+
+	case *ast.BindingPattern:
+		if err := load(); err != nil {
+			return nil, err
+		}
+		c.storeSymbol(c.symbolTable.Define(pattern.Name.Value))
+		return nil, nil
+
+	case *ast.LiteralPattern:
+		if err := load(); err != nil {
+			return nil, err
+		}
+		if err := c.Compile(pattern.Value); err != nil {
+			return nil, err
+		}
+		c.emit(code.OpEqual)
+		return []int{c.emit(code.OpJumpNotTruthy, 9999)}, nil
+
+	case *ast.ArrayPattern:
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		if err := load(); err != nil {
+			return nil, err
+		}
+		c.emit(code.OpMatchArray, len(pattern.Elements), rest)
+		fails := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		for i, el := range pattern.Elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			elFails, err := c.compilePattern(el, func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, elFails...)
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			if err := load(); err != nil {
+				return nil, err
+			}
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(len(pattern.Elements))}))
+			c.emit(code.OpNull)
+			c.emit(code.OpSlice)
+			c.storeSymbol(c.symbolTable.Define(pattern.Rest.Value))
+		}
+		return fails, nil
+
+	case *ast.HashPattern:
+		if err := load(); err != nil {
+			return nil, err
+		}
+		for _, key := range pattern.Keys {
+			if err := c.Compile(key.Value); err != nil {
+				return nil, err
+			}
+		}
+		c.emit(code.OpMatchHash, len(pattern.Keys))
+		fails := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		for i, key := range pattern.Keys {
+			key := key
+			valueFails, err := c.compilePattern(pattern.Values[i], func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				if err := c.Compile(key.Value); err != nil {
+					return err
+				}
+				c.emit(code.OpIndex)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, valueFails...)
+		}
+		return fails, nil
+	}
+
+	return nil, fmt.Errorf("unknown pattern %T", pattern)
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
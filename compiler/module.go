@@ -0,0 +1,155 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"monkey/ast"
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// Modules keeps track of the imports of a program. It's shared by the
+// compilers of all its source files, and by those of the lines of a REPL
+// session so each file is compiled once.
+type Modules struct {
+	compiled map[string]int // absolute path -> constant index of the module's body
+	loading  []moduleFile   // import chain being compiled, to detect cycles
+}
+
+type moduleFile struct {
+	abs  string
+	path string
+}
+
+// NewForFile creates a compiler for the source file at path, which its
+// imports are resolved relative to.
+func NewForFile(path string) *Compiler {
+	c := New()
+	c.SetFile(path)
+	return c
+}
+
+// SetFile sets the path of the source file being compiled.
+func (c *Compiler) SetFile(path string) {
+	c.file = path
+	c.modules = nil
+}
+
+// NewModules returns an empty set of modules.
+func NewModules() *Modules {
+	return &Modules{compiled: map[string]int{}}
+}
+
+// Copy returns a copy of m that modules can be compiled into without
+// affecting the original.
+func (m *Modules) Copy() *Modules {
+	compiled := make(map[string]int, len(m.compiled))
+	for abs, index := range m.compiled {
+		compiled[abs] = index
+	}
+	return &Modules{compiled: compiled, loading: m.loading[:len(m.loading):len(m.loading)]}
+}
+
+// SetModules makes the compiler share the modules compiled so far with
+// modules, whose bodies must be among its constants.
+func (c *Compiler) SetModules(modules *Modules) {
+	c.modules = modules
+}
+
+func (c *Compiler) imports() *Modules {
+	if c.modules == nil {
+		c.modules = NewModules()
+		if abs, err := filepath.Abs(c.file); c.file != "" && err == nil {
+			c.modules.loading = append(c.modules.loading, moduleFile{abs, c.file})
+		}
+	}
+	return c.modules
+}
+
+// compileImport compiles the imported file once into a function which
+// returns the module's namespace, a hash of its top-level lets and structs.
+// OpImport calls it the first time the import is executed.
+func (c *Compiler) compileImport(node *ast.ImportExpression) error {
+	path := node.Path.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(c.file), path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("cannot import %q: %s", node.Path.Value, err)
+	}
+
+	mods := c.imports()
+	if index, ok := mods.compiled[abs]; ok {
+		c.emit(code.OpImport, index)
+		return nil
+	}
+
+	for i, f := range mods.loading {
+		if f.abs == abs {
+			var chain []string
+			for _, f := range mods.loading[i:] {
+				chain = append(chain, f.path)
+			}
+			chain = append(chain, path)
+			return fmt.Errorf("circular import: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot import %q: %s", node.Path.Value, err)
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s: %s", path, p.Errors()[0])
+	}
+
+	mods.loading = append(mods.loading, moduleFile{abs, path})
+	defer func() { mods.loading = mods.loading[:len(mods.loading)-1] }()
+
+	root := c.symbolTable
+	for root.Outer != nil {
+		root = root.Outer
+	}
+	symbolTable := NewModuleSymbolTable(root)
+	if root.base == nil {
+		for i, v := range object.Builtins {
+			symbolTable.DefineBuiltin(i, v.Name)
+		}
+	}
+
+	module := &Compiler{
+		constants:   c.constants,
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+		file:        path,
+		modules:     mods,
+	}
+	if err := module.Compile(program); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	names := ast.TopLevelNames(program)
+	for _, name := range names {
+		sym, _ := symbolTable.Resolve(name)
+		module.emit(code.OpConstant, module.addConstant(&object.String{Value: name}))
+		module.loadSymbol(sym)
+	}
+	module.emit(code.OpHash, len(names)*2)
+	module.emit(code.OpReturnValue)
+
+	c.constants = module.constants
+	index := c.addConstant(&object.CompiledFunction{Instructions: module.curInstructions()})
+	mods.compiled[abs] = index
+
+	c.emit(code.OpImport, index)
+	return nil
+}
@@ -0,0 +1,31 @@
+package compiler
+
+import (
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// compileStruct binds the name of a struct to its record type. The methods
+// are pushed as pairs of their name and closure, which OpStruct puts into a
+// copy of the type constant.
+func (c *Compiler) compileStruct(ss *ast.StructStatement) error {
+	// defined first so methods can refer to the type
+	symbol := c.symbolTable.Define(ss.Name.Value)
+
+	for _, m := range ss.Methods {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: m.Name.Value}))
+		if err := c.Compile(m.Function); err != nil {
+			return err
+		}
+	}
+
+	rt := &object.RecordType{Name: ss.Name.Value}
+	for _, f := range ss.Fields {
+		rt.Fields = append(rt.Fields, f.Value)
+	}
+	c.emit(code.OpStruct, c.addConstant(rt), len(ss.Methods))
+
+	c.storeSymbol(symbol)
+	return nil
+}
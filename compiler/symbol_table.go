@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -21,6 +23,17 @@ type SymbolTable struct {
 	FreeSymbols    []Symbol
 	store          map[string]Symbol
 	numDefinitions int
+
+	// slots is where a module's globals are allocated from, nil otherwise
+	slots *SymbolTable
+	// names holds the names of the globals allocated from the table by
+	// index, for the VM's errors
+	names []string
+	// base holds the names every module of the program starts out with
+	base *SymbolTable
+	// block is set for the scope of a block inside a function or the
+	// program, whose names are private to it but live in Outer's slots
+	block bool
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -37,21 +50,87 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	}
 }
 
+// NewSymbolTableFrom creates a global symbol table which starts out with the
+// names defined in base, e.g. a prelude. Modules imported by the program see
+// them too.
+func NewSymbolTableFrom(base *SymbolTable) *SymbolTable {
+	st := base.Copy()
+	st.base = base
+	return st
+}
+
+// NewModuleSymbolTable creates the global scope of an imported module. Its
+// names are private to the module, but their indexes are allocated from
+// program, as all modules share the same globals at runtime.
+func NewModuleSymbolTable(program *SymbolTable) *SymbolTable {
+	for program.slots != nil {
+		program = program.slots
+	}
+
+	st := NewSymbolTable()
+	if program.base != nil {
+		st = program.base.Copy()
+	}
+	st.slots = program
+	return st
+}
+
+// NewBlockSymbolTable creates the scope of a block, e.g. a match arm. The
+// names defined in it can't be seen outside of it, but they're allocated
+// from outer like its own, as the block runs in the same frame.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{
+		Outer: outer,
+		store: map[string]Symbol{},
+		block: true,
+	}
+}
+
 func (st *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: st.numDefinitions}
+	symbol := st.allocate(name)
+	st.store[name] = symbol
+	return symbol
+}
+
+// allocate returns a symbol for a new variable of the frame st belongs to.
+func (st *SymbolTable) allocate(name string) Symbol {
+	if st.block {
+		return st.Outer.allocate(name)
+	}
+
+	owner := st
+	if st.slots != nil {
+		owner = st.slots
+	}
+	counter := &owner.numDefinitions
+
+	symbol := Symbol{Name: name, Index: *counter}
 
 	if st.Outer == nil {
 		symbol.Scope = GlobalScope
+		owner.names = append(owner.names, name)
 	} else {
 		symbol.Scope = LocalScope
 	}
 
-	st.store[name] = symbol
-	st.numDefinitions++
+	*counter++
 
 	return symbol
 }
 
+// DefineHidden defines a variable only the compiler uses, e.g. to hold a
+// value while it's taken apart. Names containing '@' can't clash with the
+// program's. A table defines each hidden name once, it's reused after that.
+func (st *SymbolTable) DefineHidden(name string) Symbol {
+	if st.block {
+		return st.Outer.DefineHidden(name)
+	}
+	if symbol, ok := st.store[name]; ok {
+		return symbol
+	}
+	return st.Define(name)
+}
+
 func (st *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	st.store[name] = symbol
@@ -66,6 +145,9 @@ func (st *SymbolTable) DefineFunctionName(name string) Symbol {
 
 func (st *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := st.store[name]
+	if !ok && st.block {
+		return st.Outer.Resolve(name)
+	}
 	if !ok && st.Outer != nil {
 		obj, ok = st.Outer.Resolve(name)
 		if !ok {
@@ -95,3 +177,49 @@ func (st *SymbolTable) defineFree(original Symbol) Symbol {
 	st.store[original.Name] = symbol
 	return symbol
 }
+
+// Copy returns a shallow copy of the symbol table that can be defined into
+// without affecting the original. Enclosing tables are shared.
+func (st *SymbolTable) Copy() *SymbolTable {
+	store := make(map[string]Symbol, len(st.store))
+	for name, sym := range st.store {
+		store[name] = sym
+	}
+
+	free := make([]Symbol, len(st.FreeSymbols))
+	copy(free, st.FreeSymbols)
+
+	return &SymbolTable{
+		Outer:          st.Outer,
+		FreeSymbols:    free,
+		store:          store,
+		numDefinitions: st.numDefinitions,
+		slots:          st.slots,
+		names:          st.names[:len(st.names):len(st.names)],
+		base:           st.base,
+	}
+}
+
+// NumDefinitions returns the number of symbols defined in the table itself.
+func (st *SymbolTable) NumDefinitions() int {
+	return st.numDefinitions
+}
+
+// GlobalNames returns the names of the globals allocated so far, indexed by
+// their slots.
+func (st *SymbolTable) GlobalNames() []string {
+	for st.slots != nil {
+		st = st.slots
+	}
+	return st.names
+}
+
+// Symbols returns the symbols defined in the table itself, sorted by name.
+func (st *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(st.store))
+	for _, sym := range st.store {
+		symbols = append(symbols, sym)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
@@ -1,6 +1,9 @@
 package compiler
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestDefine(t *testing.T) {
 	expected := map[string]Symbol{
@@ -286,6 +289,48 @@ func TestResolveUnresolvableFree(t *testing.T) {
 	}
 }
 
+func TestBlock(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("b")
+
+	local := NewEnclosedSymbolTable(outer)
+	local.Define("c")
+
+	block := NewBlockSymbolTable(local)
+	block.Define("a")
+
+	expected := []Symbol{
+		{Name: "a", Scope: LocalScope, Index: 1},
+		{Name: "b", Scope: FreeScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := block.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	// the slot and the free variable belong to the function's table
+	if local.NumDefinitions() != 2 {
+		t.Errorf("wrong number of definitions. want=2, got=%d", local.NumDefinitions())
+	}
+	if len(local.FreeSymbols) != 1 || len(block.FreeSymbols) != 0 {
+		t.Errorf("free symbols defined in the wrong table: %+v, %+v", local.FreeSymbols, block.FreeSymbols)
+	}
+	if result, _ := local.Resolve("a"); result.Scope != GlobalScope {
+		t.Errorf("block name visible outside of it: %+v", result)
+	}
+}
+
 func TestDefineAndResolveFunctionName(t *testing.T) {
 	global := NewSymbolTable()
 	global.DefineFunctionName("a")
@@ -316,3 +361,35 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
 	}
 }
+
+func TestCopy(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	copied := global.Copy()
+	copied.Define("b")
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("defining in the copy leaked into the original")
+	}
+
+	c := global.Define("c")
+	if c.Index != 1 {
+		t.Errorf("original symbol table index wrong. got=%d, want=%d", c.Index, 1)
+	}
+
+	a, ok := copied.Resolve("a")
+	if !ok {
+		t.Fatalf("name a not resolvable in the copy")
+	}
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("expected a to resolve to %+v, got=%+v", Symbol{Name: "a", Scope: GlobalScope, Index: 0}, a)
+	}
+
+	if names := strings.Join(global.GlobalNames(), ","); names != "a,c" {
+		t.Errorf("wrong global names of the original. want=%q, got=%q", "a,c", names)
+	}
+	if names := strings.Join(copied.GlobalNames(), ","); names != "a,b" {
+		t.Errorf("wrong global names of the copy. want=%q, got=%q", "a,b", names)
+	}
+}
@@ -2,25 +2,25 @@ package eval
 
 import (
 	"fmt"
+	"strings"
 
 	"monkey/ast"
 	"monkey/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
-var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
-}
+var builtins = func() map[string]*object.Builtin {
+	m := make(map[string]*object.Builtin, len(object.Builtins))
+	for _, b := range object.Builtins {
+		m[b.Name] = b.Builtin
+	}
+	return m
+}()
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
@@ -32,8 +32,26 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
+		if node.Pattern != nil {
+			return destructure(node.Pattern, val, env)
+		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.StructStatement:
+		rt := &object.RecordType{Name: node.Name.Value, Methods: map[string]object.Object{}}
+		for _, f := range node.Fields {
+			rt.Fields = append(rt.Fields, f.Value)
+		}
+		// set first so methods can refer to the type
+		env.Set(node.Name.Value, rt)
+		for _, m := range node.Methods {
+			method := Eval(m.Function, env)
+			if isError(method) {
+				return method
+			}
+			rt.Methods[m.Name.Value] = method
+		}
+
 	case *ast.Identifier:
 		if val, ok := env.Get(node.Value); ok {
 			return val
@@ -44,10 +62,27 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return newError("identifier not found: " + node.Value)
 
 	case *ast.FunctionLiteral:
+		// defaults are evaluated once, when the function is defined
+		defaults := []object.Object{}
+		for _, d := range node.Defaults {
+			if d == nil {
+				continue
+			}
+			val := Eval(d, env)
+			if isError(val) {
+				return val
+			}
+			defaults = append(defaults, val)
+		}
+
 		return &object.Function{
-			Params: node.Params,
-			Body:   node.Body,
-			Env:    env,
+			Params:    node.Params,
+			Patterns:  node.ParamPatterns,
+			Defaults:  defaults,
+			Variadic:  node.Variadic,
+			Generator: node.Generator,
+			Body:      node.Body,
+			Env:       env,
 		}
 
 	case *ast.CallExpression:
@@ -66,7 +101,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(fn, args)
+		return applyFunction(fn, args, env)
+
+	case *ast.InterpolatedString:
+		var out strings.Builder
+		for _, p := range node.Parts {
+			part := Eval(p, env)
+			if isError(part) {
+				return part
+			}
+			out.WriteString(part.Inspect())
+		}
+		return &object.String{Value: out.String()}
 
 	case *ast.ArrayLiteral:
 		elts := evalExpressions(node.Elements, env)
@@ -76,8 +122,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Array{Elements: elts}
 
 	case *ast.HashLiteral:
-		pairs := map[object.HashKey]object.HashPair{}
-		for k, v := range node.Pairs {
+		hash := object.NewHash()
+		for _, k := range node.Keys {
 			key := Eval(k, env)
 			if isError(key) {
 				return key
@@ -86,14 +132,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			if !ok {
 				return newError("unusable as hash key: %s", key.Type())
 			}
-			value := Eval(v, env)
+			value := Eval(node.Pairs[k], env)
 			if isError(value) {
 				return value
 			}
-			hashed := hashKey.HashKey()
-			pairs[hashed] = object.HashPair{Key: key, Value: value}
+			hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
 		}
-		return &object.Hash{Pairs: pairs}
+		return hash
 
 	case *ast.BlockStatement:
 		var result object.Object
@@ -108,6 +153,28 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.YieldStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if val == nil {
+			val = NULL
+		}
+		g, ok := env.Get(generatorName)
+		if !ok {
+			return newError("yield outside a generator")
+		}
+		if !g.(*generator).yield(val) {
+			return stopped
+		}
+
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 
@@ -136,6 +203,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalInfixExpression(node.Operator, left, right)
 
+	case *ast.FieldExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		field, err := object.GetField(left, node.Field.Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return field
+
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -150,17 +228,31 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 			array := left.(*object.Array)
 			idx := index.(*object.Integer).Value
+			if idx < 0 {
+				// negative indices count from the end
+				idx += int64(len(array.Elements))
+			}
 			if idx < 0 || idx > int64(len(array.Elements)-1) {
 				return NULL
 			}
 			return array.Elements[idx]
+		case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+			chars := []rune(left.(*object.String).Value)
+			idx := index.(*object.Integer).Value
+			if idx < 0 {
+				idx += int64(len(chars))
+			}
+			if idx < 0 || idx > int64(len(chars)-1) {
+				return NULL
+			}
+			return &object.String{Value: string(chars[idx])}
 		case left.Type() == object.HASH_OBJ:
 			hash := left.(*object.Hash)
 			key, ok := index.(object.Hashable)
 			if !ok {
 				return newError("unusable as hash key: %s", index.Type())
 			}
-			pair, ok := hash.Pairs[key.HashKey()]
+			pair, ok := hash.Get(key.HashKey())
 			if !ok {
 				return NULL
 			}
@@ -169,6 +261,31 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return newError("index operator not supported: %s", left.Type())
 		}
 
+	case *ast.SliceExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		bounds := []object.Object{NULL, NULL}
+		for i, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				continue
+			}
+			bounds[i] = Eval(bound, env)
+			if isError(bounds[i]) {
+				return bounds[i]
+			}
+		}
+
+		slice, err := object.Slice(left, bounds[0], bounds[1])
+		if err != nil {
+			return newError("%s", err)
+		}
+		return slice
+
+	case *ast.ImportExpression:
+		return evalImport(node, env)
+
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
@@ -243,6 +360,9 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 		default:
 			return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 		}
+	} else if operator == "==" || operator == "!=" {
+		// values of different types are never equal, as in the VM
+		return nativeBoolToBoolean(object.Equal(left, right) == (operator == "=="))
 	} else if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
 		if operator != "+" {
 			return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
@@ -255,14 +375,30 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+// evalExpressions evaluates exps in order, spreading the elements of the
+// arrays in spread expressions. It returns just the error if one fails.
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if ok {
+			e = spread.Value
+		}
+
 		evaluated := Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
-		result = append(result, evaluated)
+		if !ok {
+			result = append(result, evaluated)
+			continue
+		}
+
+		array, isArray := evaluated.(*object.Array)
+		if !isArray {
+			return []object.Object{newError("cannot spread %s", evaluated.Type())}
+		}
+		result = append(result, array.Elements...)
 	}
 	return result
 }
@@ -282,13 +418,189 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalForStatement runs the body for each element until it's done or the
+// body returns. Each pass binds the loop variables in an environment of its
+// own, so they can only be seen in the body.
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	iterator, err := object.Iterate(iterable, fs.Key == nil)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	for {
+		key, value, err := iterator.Next()
+		if err != nil {
+			return newError("%s", err)
+		}
+		if value == nil {
+			return NULL
+		}
+		bodyEnv := object.NewEnclosedEnvironment(env)
+		if fs.Key != nil {
+			bodyEnv.Set(fs.Key.Value, key)
+		}
+		bodyEnv.Set(fs.Value.Value, value)
+
+		result := Eval(fs.Body, bodyEnv)
+		if result != nil && (result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ) {
+			return result
+		}
+	}
+}
+
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	value := Eval(me.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	for _, arm := range me.Arms {
+		// the names an arm binds can only be seen by its guard and body
+		armEnv := object.NewEnclosedEnvironment(env)
+		if !matchPattern(arm.Pattern, value, armEnv) {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, armEnv)
+	}
+	return NULL
+}
+
+// matchPattern reports whether value matches the pattern, binding the names
+// in it in env as it goes.
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) bool {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true
+
+	case *ast.BindingPattern:
+		env.Set(pattern.Name.Value, value)
+		return true
+
+	case *ast.LiteralPattern:
+		return object.Equal(Eval(pattern.Value, env), value)
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok || len(array.Elements) < len(pattern.Elements) ||
+			pattern.Rest == nil && len(array.Elements) != len(pattern.Elements) {
+			return false
+		}
+		for i, el := range pattern.Elements {
+			if !matchPattern(el, array.Elements[i], env) {
+				return false
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-len(pattern.Elements))
+			copy(rest, array.Elements[len(pattern.Elements):])
+			env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+		return true
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false
+		}
+		for i, key := range pattern.Keys {
+			pair, ok := hash.Get(Eval(key.Value, env).(object.Hashable).HashKey())
+			if !ok || !matchPattern(pattern.Values[i], pair.Value, env) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// destructure binds the names in a let or parameter pattern to the parts of
+// value they stand for. Like indexing, missing elements and keys are null,
+// but the value must be an array or generator, or a hash, as the pattern
+// says. It returns an error or nil.
+func destructure(pattern ast.Pattern, value object.Object, env *object.Environment) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		env.Set(pattern.Name.Value, value)
+
+	case *ast.ArrayPattern:
+		rest := pattern.Rest != nil && pattern.Rest.Value != "_"
+		array, err := object.DestructureArray(value, len(pattern.Elements), rest)
+		if err != nil {
+			return newError("%s", err)
+		}
+		for i, el := range pattern.Elements {
+			var value object.Object = NULL
+			if i < len(array.Elements) {
+				value = array.Elements[i]
+			}
+			if err := destructure(el, value, env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := []object.Object{}
+			if n := len(pattern.Elements); n < len(array.Elements) {
+				rest = append(rest, array.Elements[n:]...)
+			}
+			env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return newError("cannot destructure %s as %s", value.Type(), object.HASH_OBJ)
+		}
+		for i, key := range pattern.Keys {
+			var value object.Object = NULL
+			if pair, ok := hash.Get(Eval(key.Value, env).(object.Hashable).HashKey()); ok {
+				value = pair.Value
+			}
+			if err := destructure(pattern.Values[i], value, env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyFunction calls fn from env, which builtins see as their runtime.
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		args, err := object.BindArgs(len(fn.Params), fn.Defaults, fn.Variadic, args)
+		if err != nil {
+			return newError("%s", err)
+		}
+
 		extendedEnv := object.NewEnclosedEnvironment(fn.Env)
 		for i := range fn.Params {
 			extendedEnv.Set(fn.Params[i].Value, args[i])
 		}
+		for i, pattern := range fn.Patterns {
+			if pattern == nil {
+				continue
+			}
+			if err := destructure(pattern, args[i], extendedEnv); err != nil {
+				return err
+			}
+		}
+		if fn.Generator {
+			return newGenerator(fn.Body, extendedEnv)
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
 		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
 			// unwrap ReturnValue so it doesn't bubble up the chain
@@ -296,8 +608,18 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		}
 		return evaluated
 
+	case *object.RecordType:
+		record, err := fn.New(args)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return record
+
+	case *object.BoundMethod:
+		return applyFunction(fn.Method, append([]object.Object{fn.Receiver}, args...), env)
+
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		if result := fn.Fn(runtime{env}, args...); result != nil {
 			return result
 		}
 		return NULL
@@ -307,6 +629,22 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
+// runtime lets builtins call back into the evaluator.
+type runtime struct {
+	env *object.Environment
+}
+
+func (rt runtime) Call(fn object.Object, args ...object.Object) object.Object {
+	if result := applyFunction(fn, args, rt.env); result != nil {
+		return result
+	}
+	return NULL
+}
+
+func (rt runtime) Host() *object.Host {
+	return rt.env.Host()
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
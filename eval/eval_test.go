@@ -1,7 +1,14 @@
 package eval
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"monkey/lexer"
 	"monkey/object"
@@ -205,6 +212,10 @@ return 1;
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			`import("does/not/exist.mk")`,
+			`cannot import "does/not/exist.mk": open does/not/exist.mk: no such file or directory`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -231,6 +242,7 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 5; let b = a; b;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a: int = 5; let f = fn(x: int, y) -> int { x + y }; f(a, 1);", 6},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, evalInput(tt.input), tt.expected)
@@ -289,6 +301,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("yolo")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len(bytes("héllo"))`, 6},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`first([1, 2, 3])`, 1},
@@ -321,6 +335,141 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,c", ",")`, "[a, b, c]"},
+		{`join(["a", "b", 1], "-")`, "a-b-1"},
+		{`trim("  hi there ")`, "hi there"},
+		{`upper("MonKey")`, "MONKEY"},
+		{`lower("MonKey")`, "monkey"},
+		{`contains("monkey", "key")`, "true"},
+		{`if (contains("monkey", "donkey")) { 1 } else { 2 }`, "2"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`index_of("monkey", "key")`, "3"},
+		{`substr("monkey", 1, 3)`, "on"},
+		{`starts_with("monkey", "mon")`, "true"},
+		{`ends_with("monkey", "mon")`, "false"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`chars("abc")`, "[a, b, c]"},
+		{`chars("añb")`, "[a, ñ, b]"},
+		{`let a = 1; let b = 2; "total: ${a + b}"`, "total: 3"},
+		{`"${[1, "two"]} and ${{"k": true}}"`, "[1, two] and {k: true}"},
+		{`"${"nested ${1 + 1}"}"`, "nested 2"},
+		{`"${1 + true}"`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`"héllo"[1]`, "é"},
+		{`"abc"[3]`, "null"},
+		{`substr("héllo", 1, 3)`, "él"},
+		{`index_of("日本語", "語")`, "2"},
+		{`format("{} + {} = {}", 1, 2, [3])`, "1 + 2 = [3]"},
+		{`split("a", 1)`, "ERROR: argument to `split` must be STRING, got INTEGER"},
+		{`substr("a")`, "ERROR: wrong number of arguments. got=1, want=2 or 3"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, "[11, 12]"},
+		{`map(["a", "b"], upper)`, "[A, B]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 10)`, "20"},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { return acc * x; })`, "24"},
+		{`flat_map([1, 2], fn(x) { [x, x * 10] })`, "[1, 10, 2, 20]"},
+		{`let g = fn(n) { yield n; yield -n; }; flat_map([1, 2], g)`, "[1, -1, 2, -2]"},
+		{`flat_map([1], fn(x) { x })`, "ERROR: function passed to `flat_map` must return ARRAY or GENERATOR, got INTEGER"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`uniq([3, 1, 3, 2, 1])`, "[3, 1, 2]"},
+		{`uniq([1, "1", [1], [1], {"a": 1}, {"a": 1}, true, 1])`, "[1, 1, [1], {a: 1}, true]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, "false"},
+		{`map([1], fn(x) { })`, "[null]"},
+		{`map([1], fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`filter([1], "x")`, "ERROR: argument to `filter` must be a function, got STRING"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"b": 1, "a": 2})`, "[b, a]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`has({"a": if (false) { 1 }}, "a")`, "true"},
+		{`has({"a": 1}, "b")`, "false"},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a")`, "{b: 2}"},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); h`, "{a: 1, b: 2}"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1, b: 3, c: 4}"},
+		{`entries({1: 2, 3: 4})`, "[[1, 2], [3, 4]]"},
+		{`len({"a": 1})`, "1"},
+		{`delete({}, fn() {})`, "ERROR: unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("[1, 2.5, \"a\", true, null]")`, "[1, 2.5, a, true, null]"},
+		{`json_parse("{\"b\": 1, \"a\": 2}")`, "{b: 1, a: 2}"},
+		{`json_stringify({"b": [1, "x"], "a": json_parse("null")})`, `{"b":[1,"x"],"a":null}`},
+		{`json_stringify([1], 1)`, "[\n 1\n]"},
+		{`json_stringify(fn() {})`, "ERROR: cannot encode FUNCTION as JSON"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	var stdout bytes.Buffer
+	host := object.NewHost(strings.NewReader("line\n"), &stdout, &stdout)
+	env := object.NewEnvironmentWithHost(host)
+
+	input := `let f = fn() { print(read_line(), "") }; f(); puts(map([1], fn(x) { x })); read_file("x")`
+	result := Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	expected := "ERROR: file system access is not allowed"
+	if result.Inspect() != expected {
+		t.Errorf("wrong result. want=%q, got=%q", expected, result.Inspect())
+	}
+	if stdout.String() != "line [1]\n" {
+		t.Errorf("wrong stdout. want=%q, got=%q", "line [1]\n", stdout.String())
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := evalInput(input)
@@ -380,6 +529,10 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -394,6 +547,307 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][3:1]", "[]"},
+		{`"héllo"[1:3]`, "él"},
+		{`"monkey"[:-3]`, "mon"},
+		{"1[1:]", "ERROR: slice operator not supported: INTEGER"},
+		{`[1][:"a"]`, "ERROR: slice bound must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; [a, b, rest]", "[1, 2, [3, 4]]"},
+		{`let {name, age} = {"name": "ann", "age": 3}; [name, age]`, "[ann, 3]"},
+		{`let {"k": [x, {y}], missing} = {"k": [1, {"y": 2}]}; [x, y, missing]`, "[1, 2, null]"},
+		{"let [p, q, ...r] = [1]; [p, q, r]", "[1, null, []]"},
+		{"let [m, n] = [1, 2]; let [m, n] = [n, m]; [m, n]", "[2, 1]"},
+		{"let swap = fn([a, b]) { [b, a] }; swap([1, 2])", "[2, 1]"},
+		{`let greet = fn({name}, greeting) { greeting + " " + name }; greet({"name": "bo"}, "hi")`, "hi bo"},
+		{"let f = fn(v) { let [h, ...r] = v; fn() { h + len(r) } }; f([5, 6, 7])()", "7"},
+		{"let [a] = 1;", "ERROR: cannot destructure INTEGER as ARRAY"},
+		{"let f = fn({a}) { a }; f([1])", "ERROR: cannot destructure ARRAY as HASH"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1) + f(1, 2)", "14"},
+		{"let a = 5; let f = fn(a = 1, b = a) { [a, b] }; f()", "[1, 5]"},
+		{"let n = 1; let f = fn(x = n) { x }; let n = 2; f()", "1"},
+		{"let f = fn(a, ...rest) { rest }; [f(1), f(1, 2, 3)]", "[[], [2, 3]]"},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; [f(1), f(1, 3, 4, 5)]", "[[1, 2, []], [1, 3, [4, 5]]]"},
+		{"let add = fn(a, b, c) { a + b + c }; let xs = [2]; [add(...[1, 2, 3]), add(1, ...xs, 3)]", "[6, 6]"},
+		{"let all = fn(...xs) { xs }; all(...[1], ...[], 2, ...[3])", "[1, 2, 3]"},
+		{"map([1, 2], fn(x, scale = 10) { x * scale })", "[10, 20]"},
+		{"let f = fn([a, b] = [1, 2]) { a + b }; f()", "3"},
+		{"fn(a, b) { a + b }(1)", "ERROR: wrong number of arguments: want=2, got=1"},
+		{"fn(a, b = 1) { a + b }(1, 2, 3)", "ERROR: wrong number of arguments: want=1 to 2, got=3"},
+		{"fn(a, ...rest) { a }()", "ERROR: wrong number of arguments: want=1 or more, got=0"},
+		{"fn(a) { a }(...\"ab\")", "ERROR: cannot spread STRING"},
+		{"fn(a = missing) { a }", "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	point := `struct Point {
+  x,
+  y,
+  fn norm(p) { p.x * p.x + p.y * p.y },
+  fn add(p, q) { Point(p.x + q.x, p.y + q.y) },
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{point + "Point(1, 2)", "Point{x: 1, y: 2}"},
+		{point + "let p = Point(3, 4); [p.x, p.y, p.norm()]", "[3, 4, 25]"},
+		{point + "Point(1, 2).add(Point(3, 4))", "Point{x: 4, y: 6}"},
+		{point + "let n = Point(1, 1).norm; n()", "2"},
+		{point + "[Point(1, 2) == Point(1, 2), Point(1, 2) == Point(2, 1)]", "[true, false]"},
+		{point + "struct Other { x, y } Point(1, 2) == Other(1, 2)", "false"},
+		{point + `[type(Point(1, 2)), type(Point), type(1), type(len), type(fn() {}), type(Point(1, 2).norm)]`, "[Point, STRUCT, INTEGER, FUNCTION, FUNCTION, FUNCTION]"},
+		{point + "map([Point(1, 2), Point(3, 4)], fn(p) { p.x })", "[1, 3]"},
+		{point + "let p = Point(1, 1); map([Point(1, 2), Point(3, 4)], p.add)", "[Point{x: 2, y: 3}, Point{x: 4, y: 5}]"},
+		{"struct Box { v } map([1, 2], Box)", "[Box{v: 1}, Box{v: 2}]"},
+		{"let f = fn() { struct Local { v } Local(1).v }; f()", "1"},
+		{"struct Unit {} Unit()", "Unit{}"},
+		{point + "Point(1)", "ERROR: wrong number of arguments: want=2, got=1"},
+		{point + "Point(1, 2).z", "ERROR: Point has no field or method z"},
+		{"1.x", "ERROR: field access not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	pairs := "let pairs = fn(xs) { let g = fn() { for (k, v in xs) { yield [k, v]; } }; map(g(), fn(p) { p }) };\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{pairs + "last(pairs([1, 2, 3]))", "[2, 3]"},
+		{pairs + `last(pairs("héllo"))`, "[4, o]"},
+		{pairs + `last(pairs({"a": 1, "b": 2}))`, "[b, 2]"},
+		{"let l = 0; for (x in [1, 2]) { let l = x; } l", "0"},
+		{"let x = 9; for (x in [1, 2]) { x }; x", "9"},
+		{"let f = fn() { for (x in []) { }; x }; f()", "ERROR: identifier not found: x"},
+		{"for (k, v in [1]) { }; k", "ERROR: identifier not found: k"},
+		{"let f = fn(xs) { for (x in xs) { let y = x * 10; } y }; f([1])", "ERROR: identifier not found: y"},
+		{"let f = fn() { for (x in []) { return 1; } 0 }; f()", "0"},
+		{"let f = fn(h) { for (k in h) { if (k == 2) { return k; } } -1 }; f({1: true, 2: false})", "2"},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } } }; [f(range(0, 10)), f([1])]", "[3, null]"},
+		{"let f = fn() { for (i in range(3)) { for (j in range(3)) { if (i * j == 2) { return [i, j]; } } } }; f()", "[1, 2]"},
+		{"for (ch in \"ab\") { ch }", "null"},
+		{"if (true) { for (x in []) {} }", "null"},
+		{"for (x in 1) {}", "ERROR: cannot iterate over INTEGER"},
+		{"for (x in [1]) { x + true }", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	gen := "let gen = fn() { yield 1; yield 2; };\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{gen + "let g = gen(); [g.next(), g.next(), g.next(), g.next()]", "[1, 2, null, null]"},
+		{gen + "let pairs = fn(g) { let p = fn() { for (i, x in g) { yield [i, x]; } }; map(p(), fn(x) { x }) }; last(pairs(gen()))", "[1, 2]"},
+		{"let count = fn(from) { for (i in range(100)) { yield from + i; } }; let c = count(10); c.next(); c.next()", "11"},
+		{"let nat = fn() { let f = fn(n) { yield n; for (x in f(n + 1)) { yield x; } }; f(0) }; any(nat(), fn(x) { x > 5 })", "true"},
+		{gen + `[map(gen(), fn(x) { x * 10 }), filter(gen(), fn(x) { x > 1 }), reduce(gen(), fn(a, b) { a + b }), join(gen(), "-"), all(gen(), fn(x) { x > 0 })]`, "[[10, 20], [2], 3, 1-2, true]"},
+		{"let g = fn() { yield 1; return 5; yield 2; }; map(g(), fn(x) { x })", "[1]"},
+		{"let tree = fn(n) { if (n > 0) { for (x in tree(n - 1)) { yield x; } yield n; for (x in tree(n - 1)) { yield x; } } }; join(tree(3), \",\")", "1,2,1,3,1,2,1"},
+		{"struct R { n, fn each(r) { for (i in range(r.n)) { yield i; } } } map(R(3).each(), fn(x) { x })", "[0, 1, 2]"},
+		{gen + "[type(gen()), type(gen().next)]", "[GENERATOR, FUNCTION]"},
+		{gen + "[sort(gen(), fn(a, b) { a > b }), reverse(gen())]", "[[2, 1], [2, 1]]"},
+		{"let nat = fn() { let f = fn(n) { yield n; for (x in f(n + 1)) { yield x; } }; f(0) };\nzip(nat(), [5, 6])", "[[0, 5], [1, 6]]"},
+		{"let nat = fn() { let f = fn(n) { yield n; for (x in f(n + 1)) { yield x; } }; f(0) };\nlet [a, b] = nat(); [a, b]", "[0, 1]"},
+		{gen + "let [a, ...r] = gen(); r", "[2]"},
+		{gen + "let f = fn([a, b, c]) { c }; f(gen())", "null"},
+		{"sort(1)", "ERROR: argument to `sort` must be ARRAY or GENERATOR, got INTEGER"},
+		{"zip([1], 2)", "ERROR: argument to `zip` must be ARRAY or GENERATOR, got INTEGER"},
+		{"let bad = fn() { yield 1; 1 + true; }; let [a, b] = bad();", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"let bad = fn() { yield 1; 1 + true; }; let b = bad(); [b.next(), b.next()]", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"let bad = fn() { yield 1; 1 + true; }; for (x in bad()) { x }", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"let g = fn() { yield h.next(); }; let h = g(); h.next()", "ERROR: generator is already running"},
+		{gen + "gen().x", "ERROR: GENERATOR has no field or method x"},
+		{"map(1, fn(x) { x })", "ERROR: argument to `map` must be ARRAY or GENERATOR, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestUnreachableGeneratorsStop(t *testing.T) {
+	before := goruntime.NumGoroutine()
+	result := evalInput("let nat = fn() { for (i in range(1000)) { yield i; } }; for (i in range(100)) { nat().next(); }")
+	if isError(result) {
+		t.Fatalf("eval error: %s", result.Inspect())
+	}
+
+	// finalizers run after a collection finds the generators unreachable
+	for i := 0; i < 100 && goruntime.NumGoroutine() > before; i++ {
+		goruntime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := goruntime.NumGoroutine(); n > before {
+		t.Errorf("generators left %d goroutines running", n-before)
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/counter.mk": `let base = import("base.mk"); puts("loaded"); let next = fn(x) { x + base["step"] };`,
+		"lib/base.mk":    `let step = 10;`,
+		"lib/shapes.mk":  `struct P { x, fn get(p) { p.x } }`,
+		"a.mk":           `let b = import("b.mk");`,
+		"b.mk":           `let a = import("a.mk");`,
+		"private.mk":     `secret`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := filepath.Join(dir, "a.mk"), filepath.Join(dir, "b.mk")
+
+	tests := []struct {
+		input          string
+		expected       string
+		expectedStdout string
+	}{
+		{`let step = 1; let c = import("lib/counter.mk"); c["next"](step)`, "11", "loaded\n"},
+		{`keys(import("lib/counter.mk"))`, "[base, next]", "loaded\n"},
+		{`let get = fn() { import("lib/counter.mk") }; get()["next"](get()["base"]["step"])`, "20", "loaded\n"},
+		{`let f = fn() { import("lib/counter.mk") }; 1`, "1", ""},
+		{`let s = import("lib/shapes.mk"); s["P"](4).get()`, "4", ""},
+		{`import("a.mk")`, fmt.Sprintf("ERROR: %s: %s: circular import: %s -> %s -> %s", a, b, a, b, a), ""},
+		{`let secret = 1; import("private.mk")`, "ERROR: " + filepath.Join(dir, "private.mk") + ": identifier not found: secret", ""},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		var stdout bytes.Buffer
+		env := object.NewEnvironmentWithHost(object.NewHost(strings.NewReader(""), &stdout, &stdout))
+		SetFile(env, filepath.Join(dir, "main.mk"))
+
+		if got := Eval(program, env).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("wrong stdout for %s. want=%q, got=%q", tt.input, tt.expectedStdout, stdout.String())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	describe := `let describe = fn(v) {
+  match (v) {
+    0 => "zero",
+    -1 => "minus one",
+    "hi" => "greeting",
+    true => "yes",
+    [] => "empty",
+    [x] => "one ${x}",
+    [x, y, ...more] if x > y => "desc ${len(more)}",
+    [_, ...more] => "many ${len(more)}",
+    {"name": name, "age": a} => "${name} ${a}",
+    {} => "hash",
+    n if n > 100 => "big",
+    _ => "other",
+  }
+};
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{describe + "describe(0)", "zero"},
+		{describe + "describe(-1)", "minus one"},
+		{describe + `describe("hi")`, "greeting"},
+		{describe + "describe(true)", "yes"},
+		{describe + "describe([])", "empty"},
+		{describe + "describe([7])", "one 7"},
+		{describe + "describe([3, 2, 1, 0])", "desc 2"},
+		{describe + "describe([1, 2, 3])", "many 2"},
+		{describe + `describe({"name": "ann", "age": 3})`, "ann 3"},
+		{describe + `describe({"name": "ann"})`, "hash"},
+		{describe + "describe(101)", "big"},
+		{describe + "describe(5)", "other"},
+		{"match (5) { 1 => 2 }", "null"},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c, _ => 0 }", "6"},
+		{"match ([1, 2]) { [a, ...r] => r }", "[2]"},
+		{`match ({"a": {"b": 2}}) { {"a": {"b": b}} => b }`, "2"},
+		{"match (1) { x => match (x + 1) { y => x + y } }", "3"},
+		{"let x = 1; match (2) { x if x > 5 => 0, _ => x }", "1"},
+		{"let x = 9; match (1) { x => x }; x", "9"},
+		{"let f = fn() { match (5) { [a] => a, _ => a } }; f()", "ERROR: identifier not found: a"},
+		{"match ([1, 2]) { [a, 3] => 0, _ => a }", "ERROR: identifier not found: a"},
+		{"match (1) { x => x }; x", "ERROR: identifier not found: x"},
+		{"match (1) { _ => 1 + true }", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
 {
@@ -429,6 +883,43 @@ false: 6
 	}
 }
 
+func TestHashInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, "{}"},
+		{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+		{`{3: [1, 2], 1: {true: false}}`, "{3: [1, 2], 1: {true: false}}"},
+	}
+	for _, tt := range tests {
+		if got := evalInput(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect() output. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} != {"b": 1}`, true},
+		{"let f = fn() {}; f == f", true},
+		{"fn() {} == fn() {}", false},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, evalInput(tt.input), tt.expected)
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"errors"
+	goruntime "runtime"
+
+	"monkey/ast"
+	"monkey/object"
+)
+
+// generatorName is where the environment of a generator's call holds it,
+// for the yields in the body to find. Names containing '@' can't clash with
+// the program's.
+const generatorName = "@generator"
+
+// generator runs the body of a generator function in a goroutine of its
+// own, which takes turns with the consumer: resuming it lets the body run up
+// to its next yield and waits for the value. Once the program can't resume
+// a generator any more, one that isn't run to the end is stopped, so its
+// goroutine doesn't wait forever.
+type generator struct {
+	body    *ast.BlockStatement
+	env     *object.Environment
+	started bool
+	resumes chan struct{}
+	yields  chan object.Object // the value yielded, an *object.Error or nil once the body has returned
+	stop    chan struct{}      // closed once the generator can't be resumed
+}
+
+// stopped unwinds the body of a stopped generator, like an error does.
+var stopped = &object.Error{Message: "generator stopped"}
+
+// handle is what the program resumes a generator through. The goroutine
+// doesn't refer to it, so it becomes unreachable with the generator, and
+// its finalizer stops the goroutine.
+type handle struct {
+	g *generator
+}
+
+func newGenerator(body *ast.BlockStatement, env *object.Environment) *object.Generator {
+	g := &generator{
+		body:    body,
+		env:     env,
+		resumes: make(chan struct{}),
+		yields:  make(chan object.Object),
+		stop:    make(chan struct{}),
+	}
+	env.Set(generatorName, g)
+
+	h := &handle{g}
+	goruntime.SetFinalizer(h, func(h *handle) { close(h.g.stop) })
+	return object.NewGenerator(h.resume)
+}
+
+func (h *handle) resume() (object.Object, error) {
+	// the generator mustn't be stopped while it's running
+	defer goruntime.KeepAlive(h)
+	return h.g.resume()
+}
+
+func (g *generator) Type() object.ObjectType { return object.GENERATOR_OBJ }
+func (g *generator) Inspect() string         { return "generator" }
+
+func (g *generator) resume() (object.Object, error) {
+	if !g.started {
+		g.started = true
+		go g.run()
+	} else {
+		g.resumes <- struct{}{}
+	}
+
+	value := <-g.yields
+	if err, ok := value.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+	return value, nil
+}
+
+func (g *generator) run() {
+	result := Eval(g.body, g.env)
+	if result == stopped {
+		return
+	}
+	if !isError(result) {
+		result = nil
+	}
+	select {
+	case g.yields <- result:
+	case <-g.stop:
+	}
+}
+
+// yield hands value to the consumer and waits until it resumes the
+// generator. It returns false if the generator was stopped instead.
+func (g *generator) yield(value object.Object) bool {
+	select {
+	case g.yields <- value:
+	case <-g.stop:
+		return false
+	}
+	select {
+	case <-g.resumes:
+		return true
+	case <-g.stop:
+		return false
+	}
+}
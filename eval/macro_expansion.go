@@ -10,7 +10,7 @@ import (
 func DefineMacros(program *ast.Program, env *object.Environment) {
 	for i := len(program.Statements) - 1; i >= 0; i-- {
 		letStmt, ok := program.Statements[i].(*ast.LetStatement)
-		if !ok {
+		if !ok || letStmt.Name == nil {
 			continue
 		}
 		macroLit, ok := letStmt.Value.(*ast.MacroLiteral)
@@ -0,0 +1,128 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// Names containing '@' can't clash with the program's. The outermost
+// environment of a source file holds its path under fileName, and the state
+// of the program's imports under importsName, shared by all its modules.
+const (
+	fileName    = "@file"
+	importsName = "@imports"
+)
+
+// SetFile sets the path of the source file evaluated in env, which its
+// imports are resolved relative to.
+func SetFile(env *object.Environment, path string) {
+	env.Outermost().Set(fileName, &object.String{Value: path})
+}
+
+// imports keeps track of the modules of a program, like the compiler does.
+type imports struct {
+	loaded  map[string]object.Object // absolute path -> the module's namespace
+	loading []moduleFile             // import chain being evaluated, to detect cycles
+}
+
+type moduleFile struct {
+	abs  string
+	path string
+}
+
+func (im *imports) Type() object.ObjectType { return "IMPORTS" }
+func (im *imports) Inspect() string         { return "imports" }
+
+// programImports returns the imports of the program env belongs to.
+func programImports(env *object.Environment) *imports {
+	root := env.Outermost()
+	if im, ok := root.Get(importsName); ok {
+		return im.(*imports)
+	}
+
+	im := &imports{loaded: map[string]object.Object{}}
+	if file, ok := root.Get(fileName); ok {
+		path := file.(*object.String).Value
+		if abs, err := filepath.Abs(path); err == nil {
+			im.loading = append(im.loading, moduleFile{abs, path})
+		}
+	}
+	root.Set(importsName, im)
+	return im
+}
+
+// evalImport evaluates the imported file once, in an environment of its
+// own, and returns its namespace: a hash of its top-level lets and structs.
+func evalImport(node *ast.ImportExpression, env *object.Environment) object.Object {
+	file := ""
+	if f, ok := env.Get(fileName); ok {
+		file = f.(*object.String).Value
+	}
+
+	path := node.Path.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return newError("cannot import %q: %s", node.Path.Value, err)
+	}
+
+	im := programImports(env)
+	if namespace, ok := im.loaded[abs]; ok {
+		return namespace
+	}
+
+	for i, f := range im.loading {
+		if f.abs == abs {
+			var chain []string
+			for _, f := range im.loading[i:] {
+				chain = append(chain, f.path)
+			}
+			chain = append(chain, path)
+			return newError("circular import: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return newError("cannot import %q: %s", node.Path.Value, err)
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("%s: %s", path, p.Errors()[0])
+	}
+
+	im.loading = append(im.loading, moduleFile{abs, path})
+	defer func() { im.loading = im.loading[:len(im.loading)-1] }()
+
+	// modules start out from what the program did, e.g. a prelude
+	var moduleEnv *object.Environment
+	if base := env.Base(); base != nil {
+		moduleEnv = object.NewEnvironmentFrom(base, env.Host())
+	} else {
+		moduleEnv = object.NewEnvironmentWithHost(env.Host())
+	}
+	moduleEnv.Set(importsName, im)
+	SetFile(moduleEnv, path)
+	if result := Eval(program, moduleEnv); isError(result) {
+		return newError("%s: %s", path, result.(*object.Error).Message)
+	}
+
+	namespace := object.NewHash()
+	for _, name := range ast.TopLevelNames(program) {
+		key := &object.String{Value: name}
+		value, _ := moduleEnv.Get(name)
+		namespace.Set(key.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+	im.loaded[abs] = namespace
+	return namespace
+}
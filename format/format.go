@@ -0,0 +1,713 @@
+// Package format pretty-prints Monkey source in its canonical style.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+)
+
+const indentation = "  "
+
+// Source formats a program. Comments are kept, at most one blank line
+// between statements is kept, everything else about the layout is
+// normalized.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.PositionedErrors(); len(errs) != 0 {
+		return nil, fmt.Errorf("%d:%d: %s", errs[0].Line, errs[0].Column, errs[0].Message)
+	}
+
+	pr := &printer{comments: collectComments(string(src))}
+	pr.statements(program.Statements, nil)
+
+	out := pr.buf.Bytes()
+	if len(out) > 0 {
+		out = append(out, '\n')
+	}
+	return out, nil
+}
+
+type comment struct {
+	text     string
+	line     int
+	column   int
+	endLine  int  // differs from line for block comments spanning lines
+	trailing bool // follows code on the same line
+}
+
+// before reports whether the comment comes before tok in the source.
+func (c comment) before(tok token.Token) bool {
+	return before(token.Token{Line: c.line, Column: c.column}, tok)
+}
+
+func collectComments(src string) []comment {
+	var comments []comment
+	l := lexer.New(src)
+	prevLine := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		endLine := tok.Line + strings.Count(tok.Literal, "\n")
+		if tok.Type == token.COMMENT {
+			comments = append(comments, comment{text: tok.Literal, line: tok.Line, column: tok.Column, endLine: endLine, trailing: tok.Line == prevLine})
+			continue
+		}
+		prevLine = endLine
+	}
+	return comments
+}
+
+type printer struct {
+	buf      bytes.Buffer
+	indent   int
+	comments []comment // the ones not printed yet
+	lastLine int       // last line of the source printed so far
+	embedded int       // > 0 while printing code from inside a string
+}
+
+func (p *printer) write(s ...string) {
+	for _, str := range s {
+		p.buf.WriteString(str)
+	}
+}
+
+func (p *printer) newline() {
+	p.buf.WriteString("\n")
+	p.buf.WriteString(strings.Repeat(indentation, p.indent))
+}
+
+func (p *printer) saw(tok token.Token) {
+	if p.embedded == 0 && tok.Line > p.lastLine {
+		p.lastLine = tok.Line
+	}
+}
+
+// statements prints each statement on its own line along with the comments
+// before it, up to the end token of the enclosing block (nil for the
+// program).
+func (p *printer) statements(stmts []ast.Statement, end *token.Token) {
+	first := true
+	separate := func(line int) {
+		if !first {
+			p.newline()
+			if line > p.lastLine+1 {
+				// keep a single blank line
+				p.buf.Truncate(p.buf.Len() - len(indentation)*p.indent)
+				p.newline()
+			}
+		}
+		first = false
+	}
+
+	for i, s := range stmts {
+		start := statementToken(s)
+		for len(p.comments) > 0 && p.comments[0].line < start.Line {
+			c := p.comments[0]
+			p.comments = p.comments[1:]
+			separate(c.line)
+			p.write(c.text)
+			p.lastLine = c.endLine
+		}
+
+		separate(start.Line)
+		p.inlineComments(start)
+		p.statement(s)
+		// comments before the next statement on its line go with it
+		if i+1 == len(stmts) {
+			p.trailingComments(end)
+		} else if statementToken(stmts[i+1]).Line != p.lastLine {
+			p.trailingComments(nil)
+		}
+	}
+
+	for len(p.comments) > 0 && (end == nil || p.comments[0].before(*end)) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		separate(c.line)
+		p.write(c.text)
+		p.lastLine = c.endLine
+	}
+}
+
+// trailingComments prints the comments following the code on the last line
+// printed, up to the end token of the enclosing block or list if there's
+// one.
+func (p *printer) trailingComments(end *token.Token) {
+	for len(p.comments) > 0 && p.comments[0].trailing && p.comments[0].line == p.lastLine && (end == nil || p.comments[0].before(*end)) {
+		p.write(" ", p.comments[0].text)
+		p.lastLine = p.comments[0].endLine
+		p.comments = p.comments[1:]
+	}
+}
+
+// commentsBeforeToken prints the comments before tok, each on a line of its
+// own.
+func (p *printer) commentsBeforeToken(tok token.Token) {
+	for len(p.comments) > 0 && p.comments[0].before(tok) {
+		p.newline()
+		p.write(p.comments[0].text)
+		p.lastLine = p.comments[0].endLine
+		p.comments = p.comments[1:]
+	}
+}
+
+// leadingComments prints the comments on the lines before tok, each on a
+// line of its own, the ones on its line are left to inlineComments.
+func (p *printer) leadingComments(tok token.Token) {
+	for len(p.comments) > 0 && p.comments[0].before(tok) && p.comments[0].line < tok.Line {
+		p.newline()
+		p.write(p.comments[0].text)
+		p.lastLine = p.comments[0].endLine
+		p.comments = p.comments[1:]
+	}
+}
+
+// inlineComments prints the comments right before tok on its line, like
+// `/* arg */ 2`, followed by a space.
+func (p *printer) inlineComments(tok token.Token) {
+	for len(p.comments) > 0 && p.comments[0].before(tok) && p.comments[0].line == tok.Line {
+		p.write(p.comments[0].text, " ")
+		p.lastLine = p.comments[0].endLine
+		p.comments = p.comments[1:]
+	}
+}
+
+func statementToken(s ast.Statement) token.Token {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.ExpressionStatement:
+		return s.Token
+	case *ast.StructStatement:
+		return s.Token
+	case *ast.ForStatement:
+		return s.Token
+	case *ast.YieldStatement:
+		return s.Token
+	}
+	return token.Token{}
+}
+
+func (p *printer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.saw(s.Token)
+		if s.Pattern != nil {
+			p.write("let ", s.Pattern.String())
+		} else {
+			p.write("let ", s.Name.Value)
+		}
+		if s.Type != nil {
+			p.write(": ", s.Type.String())
+		}
+		p.write(" = ")
+		p.expression(s.Value)
+		p.write(";")
+
+	case *ast.StructStatement:
+		p.saw(s.Token)
+		p.write("struct ", s.Name.Value, " {")
+		if len(s.Fields)+len(s.Methods) == 0 {
+			p.saw(s.End)
+			p.write("}")
+			return
+		}
+		// the fields and methods go in the order of the source, so the
+		// comments between them stay in place
+		var members []member
+		for _, f := range s.Fields {
+			f := f
+			members = append(members, member{f.Token, func() {
+				p.saw(f.Token)
+				p.write(f.Value)
+			}})
+		}
+		for _, m := range s.Methods {
+			m := m
+			members = append(members, member{m.Function.Token, func() {
+				p.saw(m.Function.Token)
+				p.write("fn ", m.Name.Value)
+				p.params(m.Function.Params, m.Function)
+				if m.Function.ReturnType != nil {
+					p.write(" -> ", m.Function.ReturnType.String())
+				}
+				p.write(" ")
+				p.block(m.Function.Body)
+			}})
+		}
+		sort.SliceStable(members, func(i, j int) bool { return before(members[i].start, members[j].start) })
+
+		p.indent++
+		for i, m := range members {
+			p.leadingComments(m.start)
+			p.newline()
+			p.inlineComments(m.start)
+			m.print()
+			p.write(",")
+			// comments before the next member on its line go with it
+			if i == len(members)-1 {
+				p.trailingComments(&s.End)
+			} else if members[i+1].start.Line != p.lastLine {
+				p.trailingComments(nil)
+			}
+		}
+		p.commentsBeforeToken(s.End)
+		p.indent--
+		p.newline()
+		p.saw(s.End)
+		p.write("}")
+
+	case *ast.ForStatement:
+		p.saw(s.Token)
+		p.write("for (")
+		if s.Key != nil {
+			p.saw(s.Key.Token)
+			p.write(s.Key.Value, ", ")
+		}
+		p.saw(s.Value.Token)
+		p.write(s.Value.Value, " in ")
+		p.expression(s.Iterable)
+		p.write(") ")
+		p.block(s.Body)
+
+	case *ast.ReturnStatement:
+		p.saw(s.Token)
+		p.write("return ")
+		p.expression(s.ReturnValue)
+		p.write(";")
+
+	case *ast.YieldStatement:
+		p.saw(s.Token)
+		p.write("yield ")
+		p.expression(s.Value)
+		p.write(";")
+
+	case *ast.ExpressionStatement:
+		p.saw(s.Token)
+		p.expression(s.Expression)
+		switch s.Expression.(type) {
+		case *ast.IfExpression, *ast.MatchExpression:
+		default:
+			p.write(";")
+		}
+	}
+}
+
+func (p *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.saw(e.Token)
+		p.write(e.Value)
+
+	case *ast.IntegerLiteral:
+		p.saw(e.Token)
+		p.write(e.Token.Literal)
+
+	case *ast.Boolean:
+		p.saw(e.Token)
+		p.write(e.Token.Literal)
+
+	case *ast.StringLiteral:
+		p.saw(e.Token)
+		p.write(`"`, escape(e.Value), `"`)
+
+	case *ast.InterpolatedString:
+		p.saw(e.Token)
+		p.write(`"`)
+		p.embedded++
+		for _, part := range e.Parts {
+			if sl, ok := part.(*ast.StringLiteral); ok {
+				p.write(escape(sl.Value))
+				continue
+			}
+			p.write("${")
+			p.expression(part)
+			p.write("}")
+		}
+		p.embedded--
+		p.write(`"`)
+
+	case *ast.PrefixExpression:
+		p.saw(e.Token)
+		p.write(e.Operator)
+		_, infix := e.Right.(*ast.InfixExpression)
+		p.operand(e.Right, infix)
+
+	case *ast.InfixExpression:
+		prec := parser.Precedence(e.Token.Type)
+		// operators are left-associative, so only the right operand needs
+		// parentheses at the same precedence
+		p.operand(e.Left, infixPrecedence(e.Left) < prec)
+		p.saw(e.Token)
+		p.write(" ", e.Operator, " ")
+		p.operand(e.Right, infixPrecedence(e.Right) <= prec)
+
+	case *ast.IfExpression:
+		p.saw(e.Token)
+		p.write("if (")
+		p.expression(e.Condition)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		p.saw(e.Token)
+		p.write("fn")
+		p.params(e.Params, e)
+		if e.ReturnType != nil {
+			p.write(" -> ", e.ReturnType.String())
+		}
+		p.write(" ")
+		p.block(e.Body)
+
+	case *ast.MacroLiteral:
+		p.saw(e.Token)
+		p.write("macro")
+		p.params(e.Params, nil)
+		p.write(" ")
+		p.block(e.Body)
+
+	case *ast.SpreadExpression:
+		p.saw(e.Token)
+		p.write("...")
+		p.expression(e.Value)
+
+	case *ast.CallExpression:
+		p.operand(e.Function, needsParens(e.Function))
+		p.write("(")
+		p.list(e.Arguments, e.Token, e.End)
+		p.saw(e.End)
+		p.write(")")
+
+	case *ast.ArrayLiteral:
+		p.saw(e.Token)
+		p.write("[")
+		p.list(e.Elements, e.Token, e.End)
+		p.saw(e.End)
+		p.write("]")
+
+	case *ast.HashLiteral:
+		p.saw(e.Token)
+		p.write("{")
+		p.items(len(e.Keys), e.Token, e.End, func(i int) token.Token { return startToken(e.Keys[i]) }, func(i int) {
+			p.expression(e.Keys[i])
+			p.write(": ")
+			p.expression(e.Pairs[e.Keys[i]])
+		})
+		p.saw(e.End)
+		p.write("}")
+
+	case *ast.IndexExpression:
+		p.operand(e.Left, needsParens(e.Left))
+		p.write("[")
+		p.expression(e.Index)
+		p.write("]")
+
+	case *ast.FieldExpression:
+		p.operand(e.Left, needsParens(e.Left))
+		p.write(".", e.Field.Value)
+
+	case *ast.SliceExpression:
+		p.operand(e.Left, needsParens(e.Left))
+		p.write("[")
+		if e.Start != nil {
+			p.expression(e.Start)
+		}
+		p.write(":")
+		if e.End != nil {
+			p.expression(e.End)
+		}
+		p.write("]")
+
+	case *ast.MatchExpression:
+		p.saw(e.Token)
+		p.write("match (")
+		p.expression(e.Value)
+		p.write(") {")
+		p.indent++
+		for _, arm := range e.Arms {
+			p.commentsBeforeToken(patternToken(arm.Pattern))
+			p.newline()
+			p.write(arm.Pattern.String())
+			if arm.Guard != nil {
+				p.write(" if ")
+				p.expression(arm.Guard)
+			}
+			p.write(" => ")
+			p.expression(arm.Body)
+			p.write(",")
+			p.trailingComments(&e.End)
+		}
+		p.commentsBeforeToken(e.End)
+		p.indent--
+		p.newline()
+		p.saw(e.End)
+		p.write("}")
+
+	case *ast.ImportExpression:
+		p.saw(e.Token)
+		p.write("import(", `"`, escape(e.Path.Value), `")`)
+	}
+}
+
+func (p *printer) operand(e ast.Expression, parens bool) {
+	if parens {
+		p.write("(")
+	}
+	p.expression(e)
+	if parens {
+		p.write(")")
+	}
+}
+
+// params prints the parameters of a function, with the annotations and
+// defaults of fn, or of a macro if fn is nil.
+func (p *printer) params(params []*ast.Identifier, fn *ast.FunctionLiteral) {
+	p.write("(")
+	for i, param := range params {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.saw(param.Token)
+		if fn != nil && fn.Variadic && i == len(params)-1 {
+			p.write("...")
+		}
+		p.write(param.Value)
+		if fn == nil {
+			continue
+		}
+		if typ := fn.ParamType(i); typ != nil {
+			p.write(": ", typ.String())
+		}
+		if def := fn.ParamDefault(i); def != nil {
+			p.write(" = ")
+			p.expression(def)
+		}
+	}
+	p.write(")")
+}
+
+// list prints the expressions of a list between the tokens open and end, see
+// items.
+func (p *printer) list(exps []ast.Expression, open, end token.Token) {
+	p.items(len(exps), open, end, func(i int) token.Token { return startToken(exps[i]) }, func(i int) {
+		p.expression(exps[i])
+	})
+}
+
+// items prints the n items of a list between the tokens open and end, e.g.
+// the elements of an array, separated by commas on one line, along with the
+// comments right before them on their lines. If there are other comments
+// between the items, each item and comment goes on a line of its own
+// instead, so the comments stay next to the items. start returns the first
+// token of an item and item prints it.
+func (p *printer) items(n int, open, end token.Token, start func(i int) token.Token, item func(i int)) {
+	// comments within an item, e.g. in the body of a function, are printed
+	// along with it, only those left over are between the items
+	size, comments, lastLine := p.buf.Len(), p.comments, p.lastLine
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.inlineComments(start(i))
+		item(i)
+	}
+	// comments before the list belong to an enclosing one
+	if len(p.comments) == 0 || !p.comments[0].before(end) || p.comments[0].before(open) {
+		return
+	}
+	p.buf.Truncate(size)
+	p.comments, p.lastLine = comments, lastLine
+
+	p.indent++
+	for i := 0; i < n; i++ {
+		p.leadingComments(start(i))
+		p.newline()
+		p.inlineComments(start(i))
+		item(i)
+		p.write(",")
+		// comments before the next item on its line go with it
+		if i+1 == n {
+			p.trailingComments(&end)
+		} else if start(i+1).Line != p.lastLine {
+			p.trailingComments(nil)
+		}
+	}
+	p.commentsBeforeToken(end)
+	p.indent--
+	p.newline()
+}
+
+// member is a field or method of a struct, which starts at start and is
+// printed by print.
+type member struct {
+	start token.Token
+	print func()
+}
+
+// block prints a block holding a single expression and no comments on one
+// line, e.g. fn(x) { x * 2 }, if the expression fits on it, and everything
+// else on separate lines.
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && !p.commentsBefore(b.End) {
+		p.saw(b.End)
+		p.write("{}")
+		return
+	}
+
+	if stmt, ok := p.inlineable(b); ok {
+		size, comments, lastLine := p.buf.Len(), p.comments, p.lastLine
+		p.write("{ ")
+		p.expression(stmt.Expression)
+		if !bytes.ContainsRune(p.buf.Bytes()[size:], '\n') {
+			p.saw(b.End)
+			p.write(" }")
+			return
+		}
+		p.buf.Truncate(size)
+		p.comments, p.lastLine = comments, lastLine
+	}
+
+	p.write("{")
+	p.indent++
+	p.newline()
+	p.statements(b.Statements, &b.End)
+	p.indent--
+	p.newline()
+	p.saw(b.End)
+	p.write("}")
+}
+
+func (p *printer) inlineable(b *ast.BlockStatement) (*ast.ExpressionStatement, bool) {
+	if len(b.Statements) != 1 || b.Token.Line != b.End.Line || p.commentsBefore(b.End) {
+		return nil, false
+	}
+	stmt, ok := b.Statements[0].(*ast.ExpressionStatement)
+	return stmt, ok
+}
+
+// commentsBefore reports whether there are comments left before tok.
+func (p *printer) commentsBefore(tok token.Token) bool {
+	return len(p.comments) > 0 && p.comments[0].before(tok)
+}
+
+// before reports whether a comes before b in the source.
+func before(a, b token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// startToken returns the first token of an expression.
+func startToken(e ast.Expression) token.Token {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return startToken(e.Left)
+	case *ast.CallExpression:
+		return startToken(e.Function)
+	case *ast.IndexExpression:
+		return startToken(e.Left)
+	case *ast.FieldExpression:
+		return startToken(e.Left)
+	case *ast.SliceExpression:
+		return startToken(e.Left)
+	case *ast.Identifier:
+		return e.Token
+	case *ast.IntegerLiteral:
+		return e.Token
+	case *ast.StringLiteral:
+		return e.Token
+	case *ast.InterpolatedString:
+		return e.Token
+	case *ast.Boolean:
+		return e.Token
+	case *ast.PrefixExpression:
+		return e.Token
+	case *ast.IfExpression:
+		return e.Token
+	case *ast.MatchExpression:
+		return e.Token
+	case *ast.FunctionLiteral:
+		return e.Token
+	case *ast.MacroLiteral:
+		return e.Token
+	case *ast.ArrayLiteral:
+		return e.Token
+	case *ast.HashLiteral:
+		return e.Token
+	case *ast.ImportExpression:
+		return e.Token
+	case *ast.SpreadExpression:
+		return e.Token
+	}
+	return token.Token{}
+}
+
+// patternToken returns the first token of a pattern.
+func patternToken(pattern ast.Pattern) token.Token {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return pattern.Token
+	case *ast.LiteralPattern:
+		return pattern.Token
+	case *ast.BindingPattern:
+		return pattern.Name.Token
+	case *ast.ArrayPattern:
+		return pattern.Token
+	case *ast.HashPattern:
+		return pattern.Token
+	}
+	return token.Token{}
+}
+
+// infixPrecedence returns the precedence of e if it's an infix expression,
+// or one that binds tighter than any infix operator otherwise.
+func infixPrecedence(e ast.Expression) int {
+	if ie, ok := e.(*ast.InfixExpression); ok {
+		return parser.Precedence(ie.Token.Type)
+	}
+	return parser.Precedence(token.LPAREN) + 1
+}
+
+// needsParens reports whether e needs parentheses to be called or indexed.
+func needsParens(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression, *ast.IfExpression:
+		return true
+	}
+	return false
+}
+
+func escape(s string) string {
+	var out strings.Builder
+	for i, ch := range s {
+		switch {
+		case ch == '"' || ch == '\\':
+			out.WriteRune('\\')
+			out.WriteRune(ch)
+		case ch == '\n':
+			out.WriteString(`\n`)
+		case ch == '\t':
+			out.WriteString(`\t`)
+		case ch == '\r':
+			out.WriteString(`\r`)
+		case ch == '$' && strings.HasPrefix(s[i:], "${"):
+			out.WriteString(`\$`)
+		case !unicode.IsPrint(ch):
+			fmt.Fprintf(&out, `\u{%X}`, ch)
+		default:
+			out.WriteRune(ch)
+		}
+	}
+	return out.String()
+}
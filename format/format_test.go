@@ -0,0 +1,115 @@
+package format
+
+import (
+	"testing"
+
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=1", "let x = 1;\n"},
+		{"", ""},
+		{"1 + 2 * 3; (1 + 2) * 3; 1 - (2 - 3); (1 - 2) - 3; -(a + b); !-a", "1 + 2 * 3;\n(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n-(a + b);\n!-a;\n"},
+		{"(a < b) == (c > d); (-a)(b); (a + b)[0]; (a)[1:]", "a < b == c > d;\n(-a)(b);\n(a + b)[0];\na[1:];\n"},
+		{`"q\"\\${x}$y" + "${ a[0] }\t"`, `"q\"\\${x}$y" + "${a[0]}\t";` + "\n"},
+		{`"not \${x}"`, `"not \${x}";` + "\n"},
+		{"`raw\nline`", `"raw\nline";` + "\n"},
+		{`{ "a" : [1,2], 3:{} }[3]; import( "x.mk" )`, `{"a": [1, 2], 3: {}}[3];` + "\n" + `import("x.mk");` + "\n"},
+		{"let f = fn(a,b){a+b}; map(xs, fn(x){x*2})", "let f = fn(a, b) { a + b };\nmap(xs, fn(x) { x * 2 });\n"},
+		{"let f = fn(x) {\nlet y = x;\n       y }", "let f = fn(x) {\n  let y = x;\n  y;\n};\n"},
+		{"if (a) { b } else { c }; if (a) {\nreturn b; }", "if (a) { b } else { c }\nif (a) {\n  return b;\n}\n"},
+		{"let n :int=1; let f = fn(a:[int],b) ->{string:fn(int)->bool} { a }", "let n: int = 1;\nlet f = fn(a: [int], b) -> {string: fn(int) -> bool} { a };\n"},
+		{
+			"match(x){1=>\"one\",-1=>m,[a,...r] if a>1=>a,{\"k\":v,}=>v,_=>0}\nlet y = match (x) { _ => 1 };",
+			"match (x) {\n  1 => \"one\",\n  -1 => m,\n  [a, ...r] if a > 1 => a,\n  {\"k\": v} => v,\n  _ => 0,\n}\nlet y = match (x) {\n  _ => 1,\n};\n",
+		},
+		{"let [a,b,...c]=x; let {\"k\":v,name}=y; fn([a],{b}:{string:int}){a}", "let [a, b, ...c] = x;\nlet {\"k\": v, name} = y;\nfn([a], {b}: {string: int}) { a };\n"},
+		{"let f = fn(a,b:int=1+2,...rest){rest}; f(1, ...xs,...[2])", "let f = fn(a, b: int = 1 + 2, ...rest) { rest };\nf(1, ...xs, ...[2]);\n"},
+		{
+			"struct P{x,y,fn norm(p)->int{p.x*p.y},fn long(p){\nlet a=1;\na}}\nstruct U {}\nP(1,2).norm();(-a).b",
+			"struct P {\n  x,\n  y,\n  fn norm(p) -> int { p.x * p.y },\n  fn long(p) {\n    let a = 1;\n    a;\n  },\n}\nstruct U {}\nP(1, 2).norm();\n(-a).b;\n",
+		},
+		{"for(k,v in h){puts(k)}\nfor (x in [1,2]) {\nlet y=x;\ny}", "for (k, v in h) { puts(k) }\nfor (x in [1, 2]) {\n  let y = x;\n  y;\n}\n"},
+		{"let g=fn(){yield 1\nyield  g()}", "let g = fn() {\n  yield 1;\n  yield g();\n};\n"},
+		{"macro(a) { quote(unquote(a)) }; fn() {}", "macro(a) { quote(unquote(a)) };\nfn() {};\n"},
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{
+			"// header\n\nlet a = 1; // one\nlet f = fn() {\n    // inside\n  1 // last\n\n     // end\n};\n// footer",
+			"// header\n\nlet a = 1; // one\nlet f = fn() {\n  // inside\n  1; // last\n\n  // end\n};\n// footer\n",
+		},
+		{"if (a) {\n// empty\n} else {}", "if (a) {\n  // empty\n} else {}\n"},
+		{
+			"let h = {\n  \"a\": 1, // one\n  // two\n  \"b\": [2,\n /* three */ 3]\n};\nlet c = 1;",
+			"let h = {\n  \"a\": 1, // one\n  // two\n  \"b\": [2, /* three */ 3],\n};\nlet c = 1;\n",
+		},
+		{"f(1, // one\n2)", "f(\n  1, // one\n  2,\n);\n"},
+		{"map(xs, fn(x) {\n// inside\nx })", "map(xs, fn(x) {\n  // inside\n  x;\n});\n"},
+		{"match (x) {\n  // zero\n  0 => a, // a\n  _ => b\n  // end\n}", "match (x) {\n  // zero\n  0 => a, // a\n  _ => b,\n  // end\n}\n"},
+		{"let f = fn(a) { if (a) { return a } else { a } };", "let f = fn(a) {\n  if (a) {\n    return a;\n  } else { a }\n};\n"},
+		{"fn(a) { /* c */ a }; fn(b) { b /* d */ }", "fn(a) {\n  /* c */ a;\n};\nfn(b) {\n  b; /* d */\n};\n"},
+		{"puts(1, /* arg */ 2)", "puts(1, /* arg */ 2);\n"},
+		{"puts(1, /* arg */ 2, // two\n3)", "puts(\n  1,\n  /* arg */ 2, // two\n  3,\n);\n"},
+		{"struct P {\n // the x\n x, // trailing\n y\n}", "struct P {\n  // the x\n  x, // trailing\n  y,\n}\n"},
+		{
+			"struct Q { x, fn m(p) { 1 }, // m\n /* y */ y /* end */ }",
+			"struct Q {\n  x,\n  fn m(p) { 1 }, // m\n  /* y */ y, /* end */\n}\n",
+		},
+		{
+			"/*\n * doc\n */\nlet a = 1; /* one */ /* two\n lines */\nlet b = 2;",
+			"/*\n * doc\n */\nlet a = 1; /* one */ /* two\n lines */\nlet b = 2;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", tt.input, err)
+		}
+		if string(out) != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, out)
+		}
+
+		again, err := Source(out)
+		if err != nil {
+			t.Fatalf("formatting the output of %q failed: %s", tt.input, err)
+		}
+		if string(again) != string(out) {
+			t.Errorf("formatting %q isn't idempotent.\nfirst =%q\nsecond=%q", tt.input, out, again)
+		}
+	}
+}
+
+func TestSourceKeepsMeaning(t *testing.T) {
+	inputs := []string{
+		"a - (b - c) * -d / (e + f) == !g; (a + b)(c)[d][e:f]",
+		"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)",
+		`let s = "${a + "${b}"} \n \u{1F600}"; {true: fn(x) { x }, "k": [1, [2]]}`,
+		"fn(x) { fn(y) { x + y } }(1)(2); -(-1); 1 - -1",
+		"let h = {\"a\": [1, // one\n2], // a\n\"b\": f(3, // three\n4)}",
+	}
+
+	for _, input := range inputs {
+		out, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", input, err)
+		}
+
+		before := parser.New(lexer.New(input)).ParseProgram().String()
+		after := parser.New(lexer.New(string(out))).ParseProgram().String()
+		if before != after {
+			t.Errorf("formatting changed the program.\ninput =%q\noutput=%q\nbefore=%q\nafter =%q", input, out, before, after)
+		}
+	}
+}
+
+func TestSourceSyntaxError(t *testing.T) {
+	_, err := Source([]byte("let x = 1;\nlet = 2;"))
+	if err == nil || err.Error() != "2:5: expected next token to be IDENT, got =" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -1,30 +1,58 @@
 package lexer
 
-import "monkey/token"
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"monkey/token"
+)
 
 type Lexer struct {
 	input   string
-	pos     int
-	readPos int
-	ch      byte
+	pos     int // byte offset of ch
+	readPos int // byte offset of the character after ch
+	ch      rune
+	line    int
+	column  int
+
+	// the first invalid escape sequence in the string being read, an
+	// ILLEGAL token positioned at its backslash
+	badEscape *token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var t token.Token
-
 	l.skipWhitespace()
 
+	line, column := l.line, l.column
+	t := l.readToken()
+	if t.Line == 0 {
+		// tokens are positioned at their start, unless they point at
+		// something within, like an invalid escape
+		t.Line, t.Column = line, column
+	}
+
+	return t
+}
+
+func (l *Lexer) readToken() token.Token {
+	var t token.Token
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			l.readChar()
 			t = token.Token{Type: token.EQ, Literal: "=="}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			t = token.Token{Type: token.FAT_ARROW, Literal: "=>"}
 		} else {
 			t = newToken(token.ASSIGN, l.ch)
 		}
@@ -45,7 +73,12 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		t = newToken(token.PLUS, l.ch)
 	case '-':
-		t = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			t = token.Token{Type: token.ARROW, Literal: "->"}
+		} else {
+			t = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -54,6 +87,18 @@ func (l *Lexer) NextToken() token.Token {
 			t = newToken(token.BANG, l.ch)
 		}
 	case '/':
+		if l.peekChar() == '/' {
+			// early return, the comment ends right before the newline
+			return token.Token{Type: token.COMMENT, Literal: l.readLineComment()}
+		}
+		if l.peekChar() == '*' {
+			start := l.pos
+			if !l.readBlockComment() {
+				return token.Token{Type: token.ILLEGAL, Literal: l.input[start:l.pos]}
+			}
+			t = token.Token{Type: token.COMMENT, Literal: l.input[start : l.pos+1]}
+			break
+		}
 		t = newToken(token.SLASH, l.ch)
 	case '*':
 		t = newToken(token.ASTERISK, l.ch)
@@ -61,13 +106,40 @@ func (l *Lexer) NextToken() token.Token {
 		t = newToken(token.LT, l.ch)
 	case '>':
 		t = newToken(token.GT, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.pos:], "...") {
+			l.readChar()
+			l.readChar()
+			t = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			t = newToken(token.DOT, l.ch)
+		}
 	case '{':
 		t = newToken(token.LBRACE, l.ch)
 	case '}':
 		t = newToken(token.RBRACE, l.ch)
 	case '"':
-		t.Type = token.STRING
-		t.Literal = l.readString()
+		start := l.pos
+		l.badEscape = nil
+		parts, ok := l.readString()
+		switch {
+		case !ok:
+			// unterminated, report everything we've consumed
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[start:l.pos]}
+		case l.badEscape != nil:
+			t = *l.badEscape
+		case len(parts) == 1:
+			t = token.Token{Type: token.STRING, Literal: parts[0].Text}
+		default:
+			t = token.Token{Type: token.TEMPLATE, Literal: l.input[start+1 : l.pos]}
+		}
+	case '`':
+		start := l.pos
+		if str, ok := l.readRawString(); ok {
+			t = token.Token{Type: token.STRING, Literal: str}
+		} else {
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[start:l.pos]}
+		}
 	case 0:
 		t.Literal = ""
 		t.Type = token.EOF
@@ -99,23 +171,39 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// readChar decodes the next UTF-8 encoded character into ch and keeps the
+// line and column of ch up to date.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
 	if l.readPos >= len(l.input) {
+		if l.ch != 0 || l.column == 0 {
+			// first step past the last character, EOF sits right after it
+			l.column++
+		}
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPos]
+		l.pos = len(l.input)
+		l.readPos = len(l.input)
+		return
 	}
 
+	ch, width := utf8.DecodeRuneInString(l.input[l.readPos:])
+	l.ch = ch
 	l.pos = l.readPos
-	l.readPos++
+	l.readPos += width
+	l.column++
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPos >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPos]
 	}
+
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPos:])
+	return ch
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -126,6 +214,30 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[pos:l.pos]
 }
 
+func (l *Lexer) readLineComment() string {
+	pos := l.pos
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return strings.TrimRight(l.input[pos:l.pos], "\r")
+}
+
+// readBlockComment reads up to the closing */, leaving ch on its slash. Block
+// comments don't nest. It reports false if the input ends first.
+func (l *Lexer) readBlockComment() bool {
+	l.readChar() // the opening '*'
+	for {
+		l.readChar()
+		switch {
+		case l.ch == 0:
+			return false
+		case l.ch == '*' && l.peekChar() == '/':
+			l.readChar()
+			return true
+		}
+	}
+}
+
 func (l *Lexer) readNumber() string {
 	pos := l.pos
 	for isDigit(l.ch) {
@@ -134,23 +246,190 @@ func (l *Lexer) readNumber() string {
 	return l.input[pos:l.pos]
 }
 
-func (l *Lexer) readString() string {
+// TemplatePart is a piece of a double quoted string: either text with its
+// escape sequences resolved, or the source of a `${...}` interpolation.
+type TemplatePart struct {
+	Text   string
+	IsExpr bool
+}
+
+// SplitTemplate splits the raw literal of a TEMPLATE token into its parts.
+// Text and expression parts alternate, starting and ending with text.
+func SplitTemplate(raw string) []TemplatePart {
+	l := New(`"` + raw + `"`)
+	parts, _ := l.readString()
+	return parts
+}
+
+// readString reads a double quoted string, resolving escape sequences and
+// splitting out interpolations. It reports false if the string isn't closed
+// before the end of the line.
+func (l *Lexer) readString() ([]TemplatePart, bool) {
+	var parts []TemplatePart
+	var out strings.Builder
+
+	l.readChar()
+	for l.ch != '"' {
+		switch {
+		case l.ch == 0 || l.ch == '\n':
+			return nil, false
+		case l.ch == '\\':
+			l.readEscape(&out)
+		case l.ch == '$' && l.peekChar() == '{':
+			src, ok := l.readInterpolation()
+			if !ok {
+				return nil, false
+			}
+			parts = append(parts, TemplatePart{Text: out.String()}, TemplatePart{Text: src, IsExpr: true})
+			out.Reset()
+		default:
+			out.WriteRune(l.ch)
+			l.readChar()
+		}
+	}
+
+	parts = append(parts, TemplatePart{Text: out.String()})
+	return parts, true
+}
+
+// readInterpolation returns the source between `${` and its matching `}`,
+// skipping over nested braces and strings. It leaves ch after the `}`.
+func (l *Lexer) readInterpolation() (string, bool) {
+	l.readChar()
+	l.readChar()
+
+	start := l.pos
+	depth := 1
+	for {
+		switch l.ch {
+		case 0:
+			return "", false
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				src := l.input[start:l.pos]
+				l.readChar()
+				return src, true
+			}
+		case '"':
+			if _, ok := l.readString(); !ok {
+				return "", false
+			}
+		case '`':
+			if _, ok := l.readRawString(); !ok {
+				return "", false
+			}
+		}
+		l.readChar()
+	}
+}
+
+// readEscape resolves the escape sequence starting at the current backslash.
+// Unknown or malformed sequences are kept as they were written, and the first
+// one is recorded in badEscape.
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start, line, column := l.pos, l.line, l.column
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteRune('\n')
+	case 't':
+		out.WriteRune('\t')
+	case 'r':
+		out.WriteRune('\r')
+	case '\\':
+		out.WriteRune('\\')
+	case '"':
+		out.WriteRune('"')
+	case '$':
+		out.WriteRune('$')
+	case 'u':
+		if ch, ok := l.readUnicodeEscape(); ok {
+			out.WriteRune(ch)
+			return
+		}
+		l.invalidEscape(l.input[start:l.pos], line, column)
+		out.WriteString(l.input[start:l.pos])
+		return
+	case 0, '\n':
+		// let readString report the unterminated string
+		out.WriteRune('\\')
+		return
+	default:
+		l.invalidEscape(l.input[start:l.readPos], line, column)
+		out.WriteRune('\\')
+		out.WriteRune(l.ch)
+	}
+
+	l.readChar()
+}
+
+func (l *Lexer) invalidEscape(lit string, line, column int) {
+	if l.badEscape == nil {
+		l.badEscape = &token.Token{Type: token.ILLEGAL, Literal: lit, Line: line, Column: column}
+	}
+}
+
+// readUnicodeEscape reads the `{...}` part of a \u{...} escape, with ch on the
+// `u`. It leaves ch after the closing brace, if it got that far.
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	if l.peekChar() != '{' {
+		l.readChar()
+		return 0, false
+	}
+	l.readChar()
+	l.readChar()
+
+	start := l.pos
+	for isHexDigit(l.ch) {
+		l.readChar()
+	}
+	digits := l.input[start:l.pos]
+
+	if l.ch != '}' {
+		return 0, false
+	}
+	l.readChar()
+	if digits == "" || len(digits) > 6 {
+		return 0, false
+	}
+
+	code, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(code)) {
+		return 0, false
+	}
+	return rune(code), true
+}
+
+// readRawString reads a backtick quoted string verbatim, newlines included. It
+// reports false if the input ends before the closing backtick.
+func (l *Lexer) readRawString() (string, bool) {
 	pos := l.pos + 1
 	l.readChar()
-	for l.ch != '"' && l.ch != 0 {
+	for l.ch != '`' {
+		if l.ch == 0 {
+			return "", false
+		}
 		l.readChar()
 	}
-	return l.input[pos:l.pos]
+	return l.input[pos:l.pos], true
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.Type, ch byte) token.Token {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func newToken(tokenType token.Type, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
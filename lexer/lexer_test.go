@@ -16,7 +16,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -35,6 +35,12 @@ if (5 < 10) {
 {"foo": "bar"};
 
 macro(x, y) { x + y; };
+fn(x: int) -> int {};
+x - -1;
+match (x) { [a, ...r] => a }
+struct P { x }; p.x
+for (k, v in h) {}
+yield x;
 `
 
 	tests := []struct {
@@ -144,6 +150,171 @@ macro(x, y) { x + y; };
 		{token.SEMICOLON, ";"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENT, "int"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "r"},
+		{token.RBRACKET, "]"},
+		{token.FAT_ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.RBRACE, "}"},
+		{token.STRUCT, "struct"},
+		{token.IDENT, "P"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "p"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "k"},
+		{token.COMMA, ","},
+		{token.IDENT, "v"},
+		{token.IN, "in"},
+		{token.IDENT, "h"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.YIELD, "yield"},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - wrong tokentype. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := `let größe = "héllo, 世界";
+let 变量 = größe;`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "größe"},
+		{token.ASSIGN, "="},
+		{token.STRING, "héllo, 世界"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "变量"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "größe"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - wrong tokentype. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let é = \"ü\";\n  é + 10\n"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"é", 1, 5},
+		{"=", 1, 7},
+		{"ü", 1, 9},
+		{";", 1, 12},
+		{"é", 2, 3},
+		{"+", 2, 5},
+		{"10", 2, 7},
+		{"", 3, 1},
+		{"", 3, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - wrong position for %q. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLiteral, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// heading\r\nlet a = 1 / 2; // half\n//\n/* block\n * // nested */ a /**/ * /*/ 1 */ 2"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// heading"},
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// half"},
+		{token.COMMENT, "//"},
+		{token.COMMENT, "/* block\n * // nested */"},
+		{token.IDENT, "a"},
+		{token.COMMENT, "/**/"},
+		{token.ASTERISK, "*"},
+		{token.COMMENT, "/*/ 1 */"},
+		{token.INT, "2"},
 		{token.EOF, ""},
 	}
 
@@ -161,3 +332,67 @@ macro(x, y) { x + y; };
 		}
 	}
 }
+
+func TestSplitTemplate(t *testing.T) {
+	parts := SplitTemplate(`a\t${x + "}"}b${ {1: 2}[1] }`)
+
+	expected := []TemplatePart{
+		{Text: "a\t"},
+		{Text: `x + "}"`, IsExpr: true},
+		{Text: "b"},
+		{Text: ` {1: 2}[1] `, IsExpr: true},
+		{Text: ""},
+	}
+
+	if len(parts) != len(expected) {
+		t.Fatalf("wrong number of parts. want=%d, got=%d (%+v)", len(expected), len(parts), parts)
+	}
+	for i, part := range parts {
+		if part != expected[i] {
+			t.Errorf("parts[%d] wrong. want=%+v, got=%+v", i, expected[i], part)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{`"a\"b"`, token.STRING, `a"b`},
+		{`"line\nbreak"`, token.STRING, "line\nbreak"},
+		{`"tab\there"`, token.STRING, "tab\there"},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u{48}\u{1F600}"`, token.STRING, "H😀"},
+		{`"\q\u{zz}"`, token.ILLEGAL, `\q`},
+		{`"ok \u{zz}"`, token.ILLEGAL, `\u{`},
+		{`"\u{110000}"`, token.ILLEGAL, `\u{110000}`},
+		{`"\u{D800}"`, token.ILLEGAL, `\u{D800}`},
+		{`"\u{}"`, token.ILLEGAL, `\u{}`},
+		{`"\u0041"`, token.ILLEGAL, `\u`},
+		{`"${ "\é" }"`, token.ILLEGAL, `\é`},
+		{"`raw \\n\nstring`", token.STRING, "raw \\n\nstring"},
+		{`"unterminated`, token.ILLEGAL, `"unterminated`},
+		{"\"no newlines\n\"", token.ILLEGAL, `"no newlines`},
+		{`"ends in escape\"`, token.ILLEGAL, `"ends in escape\"`},
+		{"`unterminated raw", token.ILLEGAL, "`unterminated raw"},
+		{`"sum: ${a + b}!"`, token.TEMPLATE, `sum: ${a + b}!`},
+		{`"${ {"k": "}"}["k"] }"`, token.TEMPLATE, `${ {"k": "}"}["k"] }`},
+		{`"not \${interpolated}"`, token.STRING, `not ${interpolated}`},
+		{`"${a"`, token.ILLEGAL, `"${a"`},
+		{"/* unterminated *", token.ILLEGAL, "/* unterminated *"},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - wrong tokentype. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package lsp
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/prelude"
+	"monkey/token"
+)
+
+// document is an open file along with what's known about its code.
+type document struct {
+	uri         string
+	lines       []string
+	diagnostics []diagnostic
+
+	// the following come from the last version of the document without
+	// syntax errors
+	idents []*ast.Identifier
+	defs   map[*ast.Identifier]*definition
+	global *scope
+	scopes []*scope
+}
+
+// definition is what an identifier refers to.
+type definition struct {
+	name     string
+	ident    *ast.Identifier // nil for builtins and the prelude
+	detail   string          // code shown on hover
+	doc      string
+	function bool
+}
+
+// scope mirrors a symbol table of the compiler, spanning the source between
+// start and end. The global scope spans the whole document.
+type scope struct {
+	parent     *scope
+	start, end token.Token
+	defs       []*definition
+}
+
+func newDocument(uri, text string, prev *document) *document {
+	doc := &document{uri: uri, lines: strings.Split(text, "\n")}
+
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	if errs := p.PositionedErrors(); len(errs) != 0 {
+		for _, err := range errs {
+			doc.diagnostics = append(doc.diagnostics, doc.diagnosticAt(err.Line, err.Column, err.Message))
+		}
+		if prev != nil {
+			doc.idents, doc.defs, doc.global, doc.scopes = prev.idents, prev.defs, prev.global, prev.scopes
+		}
+		return doc
+	}
+
+	comp := prelude.Load().Compiler()
+	comp.SetFile(uriToPath(uri))
+	if err := comp.Compile(program); err != nil {
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			doc.diagnostics = append(doc.diagnostics, doc.diagnosticAt(compileErr.Line, compileErr.Column, compileErr.Message))
+		} else {
+			doc.diagnostics = append(doc.diagnostics, doc.diagnosticAt(1, 1, err.Error()))
+		}
+	}
+
+	r := newResolver(doc)
+	r.walk(program)
+	return doc
+}
+
+func (d *document) diagnosticAt(line, column int, msg string) diagnostic {
+	// the end is a character further, which may take two UTF-16 units
+	start, end := d.position(line, column), d.position(line, column+1)
+	if end == start {
+		// past the end of the line
+		end.Character++
+	}
+	return diagnostic{Range: rng{start, end}, Severity: severityError, Source: "monkey", Message: msg}
+}
+
+// position converts a 1-based line and column in characters to an LSP
+// position, which counts UTF-16 code units from 0.
+func (d *document) position(line, column int) position {
+	pos := position{Line: line - 1}
+	if line < 1 || line > len(d.lines) {
+		return pos
+	}
+
+	for i, ch := range []rune(d.lines[line-1]) {
+		if i >= column-1 {
+			break
+		}
+		pos.Character += utf16Len(ch)
+	}
+	return pos
+}
+
+// column converts an LSP position back to a 1-based column in characters.
+func (d *document) column(pos position) int {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return 1
+	}
+
+	column, units := 1, 0
+	for _, ch := range d.lines[pos.Line] {
+		if units >= pos.Character {
+			break
+		}
+		units += utf16Len(ch)
+		column++
+	}
+	return column
+}
+
+// utf16Len returns the number of UTF-16 code units ch is encoded in.
+func utf16Len(ch rune) int {
+	if r1, _ := utf16.EncodeRune(ch); r1 != unicode.ReplacementChar {
+		return 2
+	}
+	return 1
+}
+
+func (d *document) identRange(ident *ast.Identifier) rng {
+	start := d.position(ident.Token.Line, ident.Token.Column)
+	end := d.position(ident.Token.Line, ident.Token.Column+utf8.RuneCountInString(ident.Value))
+	return rng{start, end}
+}
+
+// identAt returns the identifier under the cursor, or nil.
+func (d *document) identAt(pos position) *ast.Identifier {
+	line, column := pos.Line+1, d.column(pos)
+	for _, ident := range d.idents {
+		length := utf8.RuneCountInString(ident.Value)
+		if ident.Token.Line == line && ident.Token.Column <= column && column <= ident.Token.Column+length {
+			return ident
+		}
+	}
+	return nil
+}
+
+// scopeAt returns the innermost scope the cursor is in.
+func (d *document) scopeAt(pos position) *scope {
+	line, column := pos.Line+1, d.column(pos)
+	found := d.global
+	for _, s := range d.scopes {
+		if before(s.start, line, column) && !before(s.end, line, column) {
+			found = s
+		}
+	}
+	return found
+}
+
+// before reports whether tok starts before the given line and column.
+func before(tok token.Token, line, column int) bool {
+	return tok.Line < line || tok.Line == line && tok.Column < column
+}
+
+// resolver binds identifiers to their definitions, defining and resolving
+// names in the same order and scopes as the compiler does.
+type resolver struct {
+	doc      *document
+	table    *compiler.SymbolTable
+	scope    *scope
+	tables   map[*compiler.SymbolTable]map[string]*definition
+	external map[string]*definition
+	unplaced int // > 0 while walking code whose positions aren't known
+}
+
+func newResolver(doc *document) *resolver {
+	doc.defs = map[*ast.Identifier]*definition{}
+	doc.global = &scope{}
+
+	r := &resolver{
+		doc:      doc,
+		table:    compiler.NewSymbolTableFrom(prelude.Load().SymbolTable),
+		scope:    doc.global,
+		external: map[string]*definition{},
+	}
+	r.tables = map[*compiler.SymbolTable]map[string]*definition{r.table: {}}
+	return r
+}
+
+func (r *resolver) walk(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			r.walk(s)
+		}
+
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			r.walk(node.Value)
+			r.pattern(node.Pattern, "let ")
+			return
+		}
+
+		// defined first, like the compiler does for recursive closures
+		def := r.define(node.Name, "let "+node.Name.Value)
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			def.detail += " = " + signature(fn)
+			def.function = true
+		}
+		r.walk(node.Value)
+
+	case *ast.StructStatement:
+		// defined first so methods can refer to the type
+		def := r.define(node.Name, structSignature(node))
+		def.function = true
+		for _, m := range node.Methods {
+			r.walk(m.Function)
+		}
+
+	case *ast.ForStatement:
+		r.walk(node.Iterable)
+		r.block(func() {
+			if node.Key != nil {
+				r.define(node.Key, "for "+node.Key.Value)
+			}
+			r.define(node.Value, "for "+node.Value.Value)
+			r.walk(node.Body)
+		})
+
+	case *ast.ReturnStatement:
+		r.walk(node.ReturnValue)
+
+	case *ast.YieldStatement:
+		r.walk(node.Value)
+
+	case *ast.ExpressionStatement:
+		r.walk(node.Expression)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			r.walk(s)
+		}
+
+	case *ast.Identifier:
+		r.use(node)
+
+	case *ast.PrefixExpression:
+		r.walk(node.Right)
+
+	case *ast.InfixExpression:
+		r.walk(node.Left)
+		r.walk(node.Right)
+
+	case *ast.IfExpression:
+		r.walk(node.Condition)
+		r.walk(node.Consequence)
+		if node.Alternative != nil {
+			r.walk(node.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		for _, d := range node.Defaults {
+			if d != nil {
+				r.walk(d)
+			}
+		}
+		r.function(node.Token, node.Params, node.ParamPatterns, node.Body)
+
+	case *ast.MacroLiteral:
+		r.function(node.Token, node.Params, nil, node.Body)
+
+	case *ast.CallExpression:
+		r.walk(node.Function)
+		for _, a := range node.Arguments {
+			r.walk(a)
+		}
+
+	case *ast.SpreadExpression:
+		r.walk(node.Value)
+
+	case *ast.FieldExpression:
+		r.walk(node.Left)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			r.walk(el)
+		}
+
+	case *ast.HashLiteral:
+		for _, k := range node.Keys {
+			r.walk(k)
+			r.walk(node.Pairs[k])
+		}
+
+	case *ast.IndexExpression:
+		r.walk(node.Left)
+		r.walk(node.Index)
+
+	case *ast.SliceExpression:
+		r.walk(node.Left)
+		if node.Start != nil {
+			r.walk(node.Start)
+		}
+		if node.End != nil {
+			r.walk(node.End)
+		}
+
+	case *ast.MatchExpression:
+		r.walk(node.Value)
+		for _, arm := range node.Arms {
+			arm := arm
+			r.block(func() {
+				r.pattern(arm.Pattern, "match ")
+				if arm.Guard != nil {
+					r.walk(arm.Guard)
+				}
+				r.walk(arm.Body)
+			})
+		}
+
+	case *ast.InterpolatedString:
+		// embedded expressions are parsed on their own, so the positions of
+		// their tokens are relative to the expression
+		r.unplaced++
+		for _, p := range node.Parts {
+			r.walk(p)
+		}
+		r.unplaced--
+	}
+}
+
+// pattern defines the names a pattern binds, with details starting with
+// prefix.
+func (r *resolver) pattern(pattern ast.Pattern, prefix string) {
+	for _, name := range ast.PatternNames(pattern) {
+		r.define(name, prefix+name.Value)
+	}
+}
+
+// block walks in a block scope, see compiler.NewBlockSymbolTable. Its names
+// are offered for completion in the enclosing scope.
+func (r *resolver) block(walk func()) {
+	r.table = compiler.NewBlockSymbolTable(r.table)
+	r.tables[r.table] = map[string]*definition{}
+	walk()
+	r.table = r.table.Outer
+}
+
+func (r *resolver) function(start token.Token, params []*ast.Identifier, patterns []ast.Pattern, body *ast.BlockStatement) {
+	r.table = compiler.NewEnclosedSymbolTable(r.table)
+	r.tables[r.table] = map[string]*definition{}
+	r.scope = &scope{parent: r.scope, start: start, end: body.End}
+	r.doc.scopes = append(r.doc.scopes, r.scope)
+
+	for i, p := range params {
+		if i < len(patterns) && patterns[i] != nil {
+			// the argument is bound to the pattern's names instead
+			r.table.Define(p.Value)
+			r.pattern(patterns[i], "parameter ")
+			continue
+		}
+		r.define(p, "parameter "+p.Value)
+	}
+	r.walk(body)
+
+	r.table = r.table.Outer
+	r.scope = r.scope.parent
+}
+
+func (r *resolver) define(ident *ast.Identifier, detail string) *definition {
+	def := &definition{name: ident.Value, ident: ident, detail: detail}
+	r.table.Define(ident.Value)
+	r.tables[r.table][ident.Value] = def
+	r.scope.defs = append(r.scope.defs, def)
+	r.record(ident, def)
+	return def
+}
+
+func (r *resolver) use(ident *ast.Identifier) {
+	sym, ok := r.table.Resolve(ident.Value)
+	if !ok {
+		return // reported by the compiler
+	}
+
+	for t := r.table; t != nil; t = t.Outer {
+		if def, ok := r.tables[t][ident.Value]; ok {
+			r.record(ident, def)
+			return
+		}
+	}
+
+	def, ok := r.external[ident.Value]
+	if !ok {
+		def = externalDefinition(sym)
+		r.external[ident.Value] = def
+	}
+	r.record(ident, def)
+}
+
+func (r *resolver) record(ident *ast.Identifier, def *definition) {
+	if r.unplaced > 0 {
+		return
+	}
+	r.doc.idents = append(r.doc.idents, ident)
+	r.doc.defs[ident] = def
+}
+
+func externalDefinition(sym compiler.Symbol) *definition {
+	def := &definition{name: sym.Name, detail: sym.Name, doc: "Defined in the prelude.", function: true}
+	if sym.Scope == compiler.BuiltinScope {
+		def.doc = "Builtin function."
+		if doc, ok := builtinDocs[sym.Name]; ok {
+			def.detail, def.doc = doc.signature, doc.doc
+		}
+	}
+	return def
+}
+
+func signature(fn *ast.FunctionLiteral) string {
+	names := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		names[i] = p.Value
+		if fn.Variadic && i == len(fn.Params)-1 {
+			names[i] = "..." + names[i]
+		}
+		if def := fn.ParamDefault(i); def != nil {
+			names[i] += " = " + def.String()
+		}
+	}
+	return "fn(" + strings.Join(names, ", ") + ")"
+}
+
+// structSignature lists the fields and method signatures of a struct.
+func structSignature(ss *ast.StructStatement) string {
+	members := []string{}
+	for _, f := range ss.Fields {
+		members = append(members, f.Value)
+	}
+	for _, m := range ss.Methods {
+		members = append(members, "fn "+m.Name.Value+strings.TrimPrefix(signature(m.Function), "fn"))
+	}
+	return "struct " + ss.Name.Value + " { " + strings.Join(members, ", ") + " }"
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
@@ -0,0 +1,54 @@
+package lsp
+
+// builtinDocs describes the builtins on hover.
+var builtinDocs = map[string]struct {
+	signature string
+	doc       string
+}{
+	"puts":           {"puts(values...)", "Prints each value on its own line."},
+	"print":          {"print(values...)", "Prints the values separated by spaces, without a newline."},
+	"eprint":         {"eprint(values...)", "Like print, but to standard error."},
+	"read_line":      {"read_line()", "Returns the next line of input, or null at the end of it."},
+	"read_file":      {"read_file(path)", "Returns the contents of a file. Needs file system access."},
+	"write_file":     {"write_file(path, content)", "Writes a string to a file. Needs file system access."},
+	"len":            {"len(value)", "Returns the length of a string in characters, or of an array or hash."},
+	"first":          {"first(array)", "Returns the first element, or null if the array is empty."},
+	"last":           {"last(array)", "Returns the last element, or null if the array is empty."},
+	"rest":           {"rest(array)", "Returns a copy of the array without its first element."},
+	"push":           {"push(array, value)", "Returns a copy of the array with the value appended."},
+	"split":          {"split(s, sep)", "Splits the string around each separator."},
+	"join":           {"join(array, sep)", "Joins the strings of the array with the separator."},
+	"trim":           {"trim(s)", "Removes leading and trailing whitespace."},
+	"upper":          {"upper(s)", "Returns the string in upper case."},
+	"lower":          {"lower(s)", "Returns the string in lower case."},
+	"contains":       {"contains(s, substr)", "Reports whether the substring is in the string."},
+	"replace":        {"replace(s, from, to)", "Replaces all occurrences of from with to."},
+	"index_of":       {"index_of(s, substr)", "Returns the position of the first occurrence of the substring, or -1."},
+	"substr":         {"substr(s, start, end?)", "Returns the characters from start to end, exclusive."},
+	"starts_with":    {"starts_with(s, prefix)", "Reports whether the string begins with the prefix."},
+	"ends_with":      {"ends_with(s, suffix)", "Reports whether the string ends with the suffix."},
+	"repeat":         {"repeat(s, count)", "Returns the string repeated count times."},
+	"chars":          {"chars(s)", "Returns the characters of the string."},
+	"format":         {"format(fmt, values...)", "Replaces each {} in the format string with the next value."},
+	"bytes":          {"bytes(s)", "Returns the UTF-8 bytes of the string."},
+	"map":            {"map(array, fn)", "Returns a new array with fn applied to each element."},
+	"filter":         {"filter(array, fn)", "Returns the elements fn is truthy for."},
+	"reduce":         {"reduce(array, fn, initial?)", "Folds the array into a single value with fn(acc, element)."},
+	"flat_map":       {"flat_map(array, fn)", "Returns the elements of the arrays fn returns for each element, in order."},
+	"sort":           {"sort(array, less?)", "Returns a sorted copy of the array or generator. less(a, b) is true if a goes before b."},
+	"reverse":        {"reverse(value)", "Returns a reversed copy of an array, generator or string."},
+	"uniq":           {"uniq(array)", "Returns the elements of the array or generator without repeats, in order."},
+	"range":          {"range(start?, end, step?)", "Returns the integers from start up to end, exclusive."},
+	"zip":            {"zip(arrays...)", "Pairs up the elements of the arrays or generators, stopping at the shortest one."},
+	"any":            {"any(array, fn)", "Reports whether fn is truthy for any element."},
+	"all":            {"all(array, fn)", "Reports whether fn is truthy for all elements."},
+	"keys":           {"keys(hash)", "Returns the keys of the hash in insertion order."},
+	"values":         {"values(hash)", "Returns the values of the hash in insertion order."},
+	"has":            {"has(hash, key)", "Reports whether the hash has the key."},
+	"delete":         {"delete(hash, key)", "Returns a copy of the hash without the key."},
+	"merge":          {"merge(hashes...)", "Returns a new hash with the pairs of all hashes, later ones win."},
+	"entries":        {"entries(hash)", "Returns the [key, value] pairs of the hash."},
+	"json_parse":     {"json_parse(s)", "Decodes a JSON document."},
+	"json_stringify": {"json_stringify(value, indent?)", "Encodes a value as JSON."},
+	"type":           {"type(value)", "Returns the name of the value's type, the struct's name for records."},
+}
@@ -0,0 +1,268 @@
+// Package lsp implements a Language Server Protocol server for Monkey over
+// stdio, see https://microsoft.github.io/language-server-protocol/.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"monkey/compiler"
+	"monkey/prelude"
+	"monkey/token"
+)
+
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*document
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: map[string]*document{}}
+}
+
+// Serve handles messages until the client sends exit or closes the input.
+func (s *Server) Serve() error {
+	for {
+		if _, err := s.in.Peek(1); err == io.EOF {
+			return nil
+		}
+
+		req, err := readMessage(s.in)
+		if err != nil {
+			return err
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *message) error {
+	result, rerr := s.dispatch(req)
+
+	// notifications don't get a response
+	if req.ID == nil {
+		return nil
+	}
+
+	resp := &message{ID: req.ID, Error: rerr}
+	if rerr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = raw
+	}
+	return writeMessage(s.out, resp)
+}
+
+func (s *Server) dispatch(req *message) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"positionEncoding":   "utf-16",
+				"textDocumentSync":   1, // full content on every change
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "monkey"},
+		}, nil
+
+	case "initialized", "shutdown", "$/cancelRequest":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(params.TextDocument.URI, text)
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.publish(params.TextDocument.URI, []diagnostic{})
+
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.definition(params), nil
+
+	case "textDocument/references":
+		var params referenceParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.references(params), nil
+
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(params), nil
+
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(params), nil
+	}
+
+	if req.ID == nil {
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+func (s *Server) update(uri, text string) *responseError {
+	doc := newDocument(uri, text, s.docs[uri])
+	s.docs[uri] = doc
+
+	diagnostics := doc.diagnostics
+	if diagnostics == nil {
+		diagnostics = []diagnostic{}
+	}
+	return s.publish(uri, diagnostics)
+}
+
+func (s *Server) publish(uri string, diagnostics []diagnostic) *responseError {
+	params, _ := json.Marshal(publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+	msg := &message{Method: "textDocument/publishDiagnostics", Params: params}
+	if err := writeMessage(s.out, msg); err != nil {
+		return &responseError{Message: err.Error()}
+	}
+	return nil
+}
+
+// lookup returns the document and the definition of the identifier at the
+// position, if any.
+func (s *Server) lookup(params textDocumentPositionParams) (*document, *definition) {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+
+	ident := doc.identAt(params.Position)
+	if ident == nil {
+		return doc, nil
+	}
+	return doc, doc.defs[ident]
+}
+
+func (s *Server) definition(params textDocumentPositionParams) *location {
+	doc, def := s.lookup(params)
+	if def == nil || def.ident == nil {
+		return nil
+	}
+	return &location{URI: doc.uri, Range: doc.identRange(def.ident)}
+}
+
+func (s *Server) references(params referenceParams) []location {
+	doc, def := s.lookup(params.textDocumentPositionParams)
+	locations := []location{}
+	if def == nil {
+		return locations
+	}
+
+	for _, ident := range doc.idents {
+		if doc.defs[ident] != def || ident == def.ident && !params.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, location{URI: doc.uri, Range: doc.identRange(ident)})
+	}
+	return locations
+}
+
+func (s *Server) hover(params textDocumentPositionParams) *hover {
+	doc, def := s.lookup(params)
+	if def == nil {
+		return nil
+	}
+
+	value := "```monkey\n" + def.detail + "\n```"
+	if def.doc != "" {
+		value += "\n" + def.doc
+	}
+
+	r := doc.identRange(doc.identAt(params.Position))
+	return &hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+// completion offers the names in scope at the position, innermost first,
+// then the prelude, the builtins and the keywords.
+func (s *Server) completion(params textDocumentPositionParams) []completionItem {
+	items := []completionItem{}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return items
+	}
+
+	seen := map[string]bool{}
+	add := func(label string, kind int, detail string) {
+		if !seen[label] {
+			seen[label] = true
+			items = append(items, completionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+
+	line, column := params.Position.Line+1, doc.column(params.Position)
+	for sc := doc.scopeAt(params.Position); sc != nil; sc = sc.parent {
+		for i := len(sc.defs) - 1; i >= 0; i-- {
+			def := sc.defs[i]
+			if !before(def.ident.Token, line, column) {
+				continue
+			}
+			kind := completionVariable
+			if def.function {
+				kind = completionFunction
+			}
+			add(def.name, kind, def.detail)
+		}
+	}
+
+	for _, sym := range prelude.Load().SymbolTable.Symbols() {
+		def := externalDefinition(sym)
+		if sym.Scope == compiler.BuiltinScope {
+			add(sym.Name, completionFunction, def.detail)
+		} else {
+			add(sym.Name, completionFunction, "prelude")
+		}
+	}
+
+	for _, kw := range token.Keywords() {
+		add(kw, completionKeyword, "")
+	}
+
+	return items
+}
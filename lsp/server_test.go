@@ -0,0 +1,343 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"monkey/compiler"
+	"monkey/prelude"
+)
+
+const uri = "file:///tmp/main.mk"
+
+// session sends the messages to a new server and returns all it wrote back.
+func session(t *testing.T, msgs ...string) []*message {
+	t.Helper()
+
+	var in, out bytes.Buffer
+	for _, m := range msgs {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatalf("Serve() failed: %s", err)
+	}
+
+	var replies []*message
+	r := bufio.NewReader(&out)
+	for {
+		if _, err := r.Peek(1); err != nil {
+			return replies
+		}
+		msg, err := readMessage(r)
+		if err != nil {
+			t.Fatalf("reading reply failed: %s", err)
+		}
+		replies = append(replies, msg)
+	}
+}
+
+func didOpen(text string) string {
+	params, _ := json.Marshal(map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri, "text": text},
+	})
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":%s}`, params)
+}
+
+func request(id int, method string, line, character int, extra string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":{"textDocument":{"uri":%q},"position":{"line":%d,"character":%d}%s}}`,
+		id, method, uri, line, character, extra)
+}
+
+func result(t *testing.T, replies []*message, id int, v interface{}) {
+	t.Helper()
+	for _, r := range replies {
+		if r.ID != nil && string(*r.ID) == fmt.Sprint(id) {
+			if r.Error != nil {
+				t.Fatalf("request %d failed: %s", id, r.Error.Message)
+			}
+			if err := json.Unmarshal(r.Result, v); err != nil {
+				t.Fatalf("decoding result of %d failed: %s", id, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no reply to request %d", id)
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []diagnostic
+	}{
+		{"let x = 1;\nputs(x);", []diagnostic{}},
+		{"let x = 1;\nlet = 2;", []diagnostic{
+			{Range: rng{position{1, 4}, position{1, 5}}, Severity: severityError, Source: "monkey", Message: "expected next token to be IDENT, got ="},
+		}},
+		{"let = 1;\nfoo(1;\nlet y = 2;", []diagnostic{
+			{Range: rng{position{0, 4}, position{0, 5}}, Severity: severityError, Source: "monkey", Message: "expected next token to be IDENT, got ="},
+			{Range: rng{position{1, 5}, position{1, 6}}, Severity: severityError, Source: "monkey", Message: "expected next token to be ), got ;"},
+		}},
+		{"let 世界 = 1;\n  世界 + y", []diagnostic{
+			{Range: rng{position{1, 7}, position{1, 8}}, Severity: severityError, Source: "monkey", Message: "undefined variable y"},
+		}},
+		{"let s = \"😀\"; 😀", []diagnostic{
+			{Range: rng{position{0, 14}, position{0, 16}}, Severity: severityError, Source: "monkey", Message: `illegal character "😀"`},
+		}},
+	}
+
+	for _, tt := range tests {
+		replies := session(t, didOpen(tt.input))
+		if len(replies) != 1 || replies[0].Method != "textDocument/publishDiagnostics" {
+			t.Fatalf("expected diagnostics to be published, got %+v", replies)
+		}
+
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(replies[0].Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(params.Diagnostics) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong diagnostics for %q.\nwant=%+v\ngot =%+v", tt.input, tt.expected, params.Diagnostics)
+		}
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let x = add(1, 2);
+let f = fn(x) { add(x, len("😀" + "${x}")) };
+f(x)`
+
+	replies := session(t,
+		didOpen(input),
+		request(1, "textDocument/definition", 2, 17, ""),
+		request(2, "textDocument/definition", 2, 20, ""),
+		request(3, "textDocument/references", 1, 4, `,"context":{"includeDeclaration":true}`),
+		request(4, "textDocument/references", 0, 5, `,"context":{"includeDeclaration":false}`),
+		request(5, "textDocument/definition", 2, 24, ""),
+	)
+
+	var loc location
+	result(t, replies, 1, &loc)
+	if loc.Range != (rng{position{0, 4}, position{0, 7}}) {
+		t.Errorf("definition of add wrong. got=%+v", loc.Range)
+	}
+
+	// a parameter shadows the global
+	result(t, replies, 2, &loc)
+	if loc.Range != (rng{position{2, 11}, position{2, 12}}) {
+		t.Errorf("definition of parameter x wrong. got=%+v", loc.Range)
+	}
+
+	var refs []location
+	result(t, replies, 3, &refs)
+	expected := []rng{{position{1, 4}, position{1, 5}}, {position{3, 2}, position{3, 3}}}
+	if len(refs) != len(expected) {
+		t.Fatalf("wrong number of references to x. want=%d, got=%+v", len(expected), refs)
+	}
+	for i, ref := range refs {
+		if ref.Range != expected[i] {
+			t.Errorf("references[%d] wrong. want=%+v, got=%+v", i, expected[i], ref.Range)
+		}
+	}
+
+	result(t, replies, 4, &refs)
+	if len(refs) != 2 || refs[0].Range.Start != (position{1, 8}) || refs[1].Range.Start != (position{2, 16}) {
+		t.Errorf("wrong references to add. got=%+v", refs)
+	}
+
+	var none *location
+	result(t, replies, 5, &none)
+	if none != nil {
+		t.Errorf("builtins have no definition, got=%+v", none)
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	// the emoji take two UTF-16 code units each
+	replies := session(t,
+		didOpen(`let s = "😀😀"; s + s`),
+		request(1, "textDocument/definition", 0, 20, ""),
+		request(2, "textDocument/references", 0, 4, `,"context":{"includeDeclaration":true}`),
+	)
+
+	var loc location
+	result(t, replies, 1, &loc)
+	if loc.Range != (rng{position{0, 4}, position{0, 5}}) {
+		t.Errorf("definition of s wrong. got=%+v", loc.Range)
+	}
+
+	var refs []location
+	result(t, replies, 2, &refs)
+	expected := []rng{{position{0, 4}, position{0, 5}}, {position{0, 16}, position{0, 17}}, {position{0, 20}, position{0, 21}}}
+	if len(refs) != len(expected) {
+		t.Fatalf("wrong number of references to s. want=%d, got=%+v", len(expected), refs)
+	}
+	for i, ref := range refs {
+		if ref.Range != expected[i] {
+			t.Errorf("references[%d] wrong. want=%+v, got=%+v", i, expected[i], ref.Range)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	replies := session(t,
+		didOpen("let xs = push([], 1);\nsum(xs)"),
+		request(1, "textDocument/hover", 0, 10, ""),
+		request(2, "textDocument/hover", 1, 5, ""),
+		request(3, "textDocument/hover", 1, 0, ""),
+		request(4, "textDocument/hover", 0, 20, ""),
+	)
+
+	tests := []struct {
+		id       int
+		expected string
+	}{
+		{1, "```monkey\npush(array, value)\n```\nReturns a copy of the array with the value appended."},
+		{2, "```monkey\nlet xs\n```"},
+		{3, "```monkey\nsum\n```\nDefined in the prelude."},
+	}
+	for _, tt := range tests {
+		var h hover
+		result(t, replies, tt.id, &h)
+		if h.Contents.Value != tt.expected {
+			t.Errorf("wrong hover %d. want=%q, got=%q", tt.id, tt.expected, h.Contents.Value)
+		}
+	}
+
+	var none *hover
+	result(t, replies, 4, &none)
+	if none != nil {
+		t.Errorf("expected no hover outside identifiers, got=%+v", none)
+	}
+}
+
+func TestMatchBindings(t *testing.T) {
+	replies := session(t,
+		didOpen("let v = match ([1, 2]) { [a, ...r] => a + len(r) };"),
+		request(1, "textDocument/definition", 0, 38, ""),
+		request(2, "textDocument/hover", 0, 46, ""),
+	)
+
+	var loc location
+	result(t, replies, 1, &loc)
+	if loc.Range != (rng{position{0, 26}, position{0, 27}}) {
+		t.Errorf("definition of a wrong. got=%+v", loc.Range)
+	}
+
+	var h hover
+	result(t, replies, 2, &h)
+	if h.Contents.Value != "```monkey\nmatch r\n```" {
+		t.Errorf("wrong hover for r. got=%q", h.Contents.Value)
+	}
+}
+
+func TestForBindings(t *testing.T) {
+	replies := session(t,
+		didOpen("for (k, v in {1: 2}) { puts(k + v) }"),
+		request(1, "textDocument/definition", 0, 32, ""),
+		request(2, "textDocument/hover", 0, 28, ""),
+	)
+
+	var loc location
+	result(t, replies, 1, &loc)
+	if loc.Range != (rng{position{0, 8}, position{0, 9}}) {
+		t.Errorf("definition of v wrong. got=%+v", loc.Range)
+	}
+
+	var h hover
+	result(t, replies, 2, &h)
+	if h.Contents.Value != "```monkey\nfor k\n```" {
+		t.Errorf("wrong hover for k. got=%q", h.Contents.Value)
+	}
+}
+
+func TestYieldReferences(t *testing.T) {
+	replies := session(t,
+		didOpen("let g = fn(n) { yield n + 1; }"),
+		request(1, "textDocument/definition", 0, 22, ""),
+	)
+
+	var loc location
+	result(t, replies, 1, &loc)
+	if loc.Range != (rng{position{0, 11}, position{0, 12}}) {
+		t.Errorf("definition of n wrong. got=%+v", loc.Range)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	replies := session(t,
+		didOpen("struct P { x, fn get(p, d = 1) { p.x } }\nP(1).get()"),
+		request(1, "textDocument/hover", 1, 0, ""),
+		request(2, "textDocument/definition", 0, 34, ""),
+	)
+
+	var h hover
+	result(t, replies, 1, &h)
+	if h.Contents.Value != "```monkey\nstruct P { x, fn get(p, d = 1) }\n```" {
+		t.Errorf("wrong hover for P. got=%q", h.Contents.Value)
+	}
+
+	var loc location
+	result(t, replies, 2, &loc)
+	if loc.Range != (rng{position{0, 21}, position{0, 22}}) {
+		t.Errorf("definition of p wrong. got=%+v", loc.Range)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	input := `let top = 1;
+let f = fn(param) {
+  let inner = 2;
+
+};
+let later = 3;`
+
+	replies := session(t,
+		didOpen(input),
+		request(1, "textDocument/completion", 3, 2, ""),
+		request(2, "textDocument/completion", 5, 0, ""),
+	)
+
+	labels := func(id int) []string {
+		var items []completionItem
+		result(t, replies, id, &items)
+		var labels []string
+		for _, it := range items {
+			labels = append(labels, it.Label)
+		}
+		return labels
+	}
+
+	got := strings.Join(labels(1), " ")
+	if !strings.HasPrefix(got, "inner param f top ") {
+		t.Errorf("wrong names in scope inside the function. got=%q", got)
+	}
+	for _, want := range []string{" len ", " sum ", " fn ", " let "} {
+		if !strings.Contains(got+" ", want) {
+			t.Errorf("completion misses %q. got=%q", want, got)
+		}
+	}
+	if strings.Contains(got, "later") {
+		t.Errorf("completion offers a name defined after the cursor. got=%q", got)
+	}
+
+	if got := strings.Join(labels(2), " "); !strings.HasPrefix(got, "f top ") {
+		t.Errorf("wrong names in scope after the function. got=%q", got)
+	}
+}
+
+func TestBuiltinDocs(t *testing.T) {
+	for _, sym := range prelude.Load().SymbolTable.Symbols() {
+		if sym.Scope != compiler.BuiltinScope {
+			continue
+		}
+		if _, ok := builtinDocs[sym.Name]; !ok {
+			t.Errorf("builtin %s is not documented", sym.Name)
+		}
+	}
+}
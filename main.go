@@ -1,13 +1,190 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"monkey/ast"
+	"monkey/format"
+	"monkey/lexer"
+	"monkey/lsp"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/prelude"
 	"monkey/repl"
+	"monkey/typecheck"
+	"monkey/vet"
+	"monkey/vm"
 )
 
+var allowFS = flag.Bool("allow-fs", false, "let programs read and write files")
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: monkey [flags] [file.mk | lsp | fmt [files...] | vet [files...] | check [files...]]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	host := object.NewHost(os.Stdin, os.Stdout, os.Stderr)
+	host.AllowFileSystem = *allowFS
+
+	if flag.Arg(0) == "lsp" {
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "fmt" {
+		if err := formatFiles(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if analyze, ok := analyzers[flag.Arg(0)]; ok {
+		ok, err := analyzeFiles(flag.Args()[1:], analyze)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if !ok || err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 {
+		if err := runFile(flag.Arg(0), host); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Println("Welcome to Monkey REPL")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.StartWithHost(host)
+}
+
+// formatFiles rewrites the files in the canonical style, or formats standard
+// input to standard output if there are none.
+func formatFiles(paths []string) error {
+	if len(paths) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		out, err := format.Source(src)
+		if err != nil {
+			return fmt.Errorf("<stdin>:%s", err)
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out, err := format.Source(src)
+		if err != nil {
+			return fmt.Errorf("%s:%s", path, err)
+		}
+		if !bytes.Equal(src, out) {
+			if err := os.WriteFile(path, out, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// analyzers report problems in programs without running them, as
+// "line:column: message".
+var analyzers = map[string]func(*ast.Program) []string{
+	"vet": func(program *ast.Program) []string {
+		var problems []string
+		for _, d := range vet.Check(program) {
+			problems = append(problems, d.String())
+		}
+		return problems
+	},
+	"check": func(program *ast.Program) []string {
+		var problems []string
+		for _, d := range typecheck.Check(program) {
+			problems = append(problems, d.String())
+		}
+		return problems
+	},
+}
+
+// analyzeFiles prints the problems found in the files, or in standard input
+// if there are none. It reports whether the code is free of them.
+func analyzeFiles(paths []string, analyze func(*ast.Program) []string) (bool, error) {
+	if len(paths) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return false, err
+		}
+		return analyzeSource("<stdin>", src, analyze), nil
+	}
+
+	ok := true
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		if !analyzeSource(path, src, analyze) {
+			ok = false
+		}
+	}
+	return ok, nil
+}
+
+func analyzeSource(path string, src []byte, analyze func(*ast.Program) []string) bool {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.PositionedErrors(); len(errs) != 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", path, err.Line, err.Column, err.Message)
+		}
+		return false
+	}
+
+	problems := analyze(program)
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, problem)
+	}
+	return len(problems) == 0
+}
+
+func runFile(path string, host *object.Host) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s: %s", path, p.Errors()[0])
+	}
+
+	snapshot := prelude.Load()
+	comp := snapshot.Compiler()
+	comp.SetFile(path)
+	if err := comp.Compile(program); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	machine := vm.NewWithGlobalsStore(comp.Bytecode(), snapshot.NewGlobals())
+	machine.SetHost(host)
+	return machine.Run()
 }
@@ -0,0 +1,53 @@
+package object
+
+import "fmt"
+
+// BindArgs returns the values of the numParams parameters of a function
+// called with args. Left out trailing parameters take their value from
+// defaults, which has the values of the last len(defaults) parameters before
+// the variadic one. If variadic, the last parameter gets an array of the
+// arguments beyond the others. Both engines use it so that they accept and
+// reject the same calls.
+func BindArgs(numParams int, defaults []Object, variadic bool, args []Object) ([]Object, error) {
+	fixed := numParams
+	if variadic {
+		fixed--
+	}
+	required := fixed - len(defaults)
+
+	if len(args) < required || !variadic && len(args) > fixed {
+		return nil, arityError(required, fixed, variadic, len(args))
+	}
+	if len(args) == numParams && !variadic {
+		return args, nil
+	}
+
+	values := make([]Object, 0, numParams)
+	if len(args) < fixed {
+		values = append(values, args...)
+		values = append(values, defaults[len(args)-required:]...)
+	} else {
+		values = append(values, args[:fixed]...)
+	}
+
+	if variadic {
+		rest := []Object{}
+		if len(args) > fixed {
+			rest = append(rest, args[fixed:]...)
+		}
+		values = append(values, &Array{Elements: rest})
+	}
+
+	return values, nil
+}
+
+func arityError(required, fixed int, variadic bool, got int) error {
+	switch {
+	case variadic:
+		return fmt.Errorf("wrong number of arguments: want=%d or more, got=%d", required, got)
+	case required < fixed:
+		return fmt.Errorf("wrong number of arguments: want=%d to %d, got=%d", required, fixed, got)
+	default:
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fixed, got)
+	}
+}
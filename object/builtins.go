@@ -1,6 +1,9 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"unicode/utf8"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -8,9 +11,9 @@ var Builtins = []struct {
 }{
 	{
 		"puts",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(rt Runtime, args ...Object) Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(rt.Host().Stdout, arg.Inspect())
 			}
 			return nil
 		},
@@ -18,7 +21,7 @@ var Builtins = []struct {
 	},
 	{
 		"len",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(rt Runtime, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -26,7 +29,9 @@ var Builtins = []struct {
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
 			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Hash:
+				return &Integer{Value: int64(arg.Len())}
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -35,7 +40,7 @@ var Builtins = []struct {
 	},
 	{
 		"first",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(rt Runtime, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -54,7 +59,7 @@ var Builtins = []struct {
 	},
 	{
 		"last",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(rt Runtime, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -74,7 +79,7 @@ var Builtins = []struct {
 	},
 	{
 		"rest",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(rt Runtime, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -96,7 +101,7 @@ var Builtins = []struct {
 	},
 	{
 		"push",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(rt Runtime, args ...Object) Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2", len(args))
 			}
@@ -114,6 +119,46 @@ var Builtins = []struct {
 		},
 		},
 	},
+	{"split", &Builtin{Fn: builtinSplit}},
+	{"join", &Builtin{Fn: builtinJoin}},
+	{"trim", &Builtin{Fn: builtinTrim}},
+	{"upper", &Builtin{Fn: builtinUpper}},
+	{"lower", &Builtin{Fn: builtinLower}},
+	{"contains", &Builtin{Fn: builtinContains}},
+	{"replace", &Builtin{Fn: builtinReplace}},
+	{"index_of", &Builtin{Fn: builtinIndexOf}},
+	{"substr", &Builtin{Fn: builtinSubstr}},
+	{"starts_with", &Builtin{Fn: builtinStartsWith}},
+	{"ends_with", &Builtin{Fn: builtinEndsWith}},
+	{"repeat", &Builtin{Fn: builtinRepeat}},
+	{"chars", &Builtin{Fn: builtinChars}},
+	{"format", &Builtin{Fn: builtinFormat}},
+	{"bytes", &Builtin{Fn: builtinBytes}},
+	{"map", &Builtin{Fn: builtinMap}},
+	{"filter", &Builtin{Fn: builtinFilter}},
+	{"reduce", &Builtin{Fn: builtinReduce}},
+	{"flat_map", &Builtin{Fn: builtinFlatMap}},
+	{"sort", &Builtin{Fn: builtinSort}},
+	{"reverse", &Builtin{Fn: builtinReverse}},
+	{"uniq", &Builtin{Fn: builtinUniq}},
+	{"range", &Builtin{Fn: builtinRange}},
+	{"zip", &Builtin{Fn: builtinZip}},
+	{"any", &Builtin{Fn: builtinAny}},
+	{"all", &Builtin{Fn: builtinAll}},
+	{"keys", &Builtin{Fn: builtinKeys}},
+	{"values", &Builtin{Fn: builtinValues}},
+	{"has", &Builtin{Fn: builtinHas}},
+	{"delete", &Builtin{Fn: builtinDelete}},
+	{"merge", &Builtin{Fn: builtinMerge}},
+	{"entries", &Builtin{Fn: builtinEntries}},
+	{"json_parse", &Builtin{Fn: builtinJSONParse}},
+	{"json_stringify", &Builtin{Fn: builtinJSONStringify}},
+	{"print", &Builtin{Fn: builtinPrint}},
+	{"eprint", &Builtin{Fn: builtinEprint}},
+	{"read_line", &Builtin{Fn: builtinReadLine}},
+	{"read_file", &Builtin{Fn: builtinReadFile}},
+	{"write_file", &Builtin{Fn: builtinWriteFile}},
+	{"type", &Builtin{Fn: builtinType}},
 }
 
 func GetBuiltinByName(name string) *Builtin {
@@ -128,3 +173,24 @@ func GetBuiltinByName(name string) *Builtin {
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
+
+// checkArgs verifies that the builtin called name got exactly the arguments
+// of the given types, and returns an error describing the first mismatch.
+func checkArgs(name string, args []Object, types ...ObjectType) *Error {
+	if len(args) != len(types) {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), len(types))
+	}
+	for i, typ := range types {
+		if args[i].Type() != typ {
+			return newError("argument to `%s` must be %s, got %s", name, typ, args[i].Type())
+		}
+	}
+	return nil
+}
+
+func nativeBoolToBoolean(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
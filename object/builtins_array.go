@@ -0,0 +1,409 @@
+package object
+
+import "sort"
+
+// builtinMap returns a new array with fn applied to each element.
+func builtinMap(rt Runtime, args ...Object) Object {
+	if err := checkCallbackArgs("map", args); err != nil {
+		return err
+	}
+
+	result := []Object{}
+	err := each(args[0], func(e Object) Object {
+		mapped := rt.Call(args[1], e)
+		result = append(result, mapped)
+		return mapped
+	})
+	if err != nil {
+		return err
+	}
+	return &Array{Elements: result}
+}
+
+// builtinFilter returns a new array with the elements fn is truthy for.
+func builtinFilter(rt Runtime, args ...Object) Object {
+	if err := checkCallbackArgs("filter", args); err != nil {
+		return err
+	}
+
+	result := []Object{}
+	err := each(args[0], func(e Object) Object {
+		keep := rt.Call(args[1], e)
+		if isTruthy(keep) {
+			result = append(result, e)
+		}
+		return keep
+	})
+	if err != nil {
+		return err
+	}
+	return &Array{Elements: result}
+}
+
+// builtinFlatMap returns a new array with the elements of the arrays, or the
+// values of the generators, fn returns for each element, in order.
+func builtinFlatMap(rt Runtime, args ...Object) Object {
+	if err := checkCallbackArgs("flat_map", args); err != nil {
+		return err
+	}
+
+	result := []Object{}
+	err := each(args[0], func(e Object) Object {
+		mapped := rt.Call(args[1], e)
+		if isError(mapped) {
+			return mapped
+		}
+		if mapped.Type() != ARRAY_OBJ && mapped.Type() != GENERATOR_OBJ {
+			return newError("function passed to `flat_map` must return ARRAY or GENERATOR, got %s", mapped.Type())
+		}
+		elements, err := sequence("flat_map", mapped)
+		if err != nil {
+			return err
+		}
+		result = append(result, elements...)
+		return mapped
+	})
+	if err != nil {
+		return err
+	}
+	return &Array{Elements: result}
+}
+
+// builtinReduce folds the array into a single value with fn(acc, element).
+// Without an initial value the first element is used, and an empty array
+// reduces to null.
+func builtinReduce(rt Runtime, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	if err := checkCallbackArgs("reduce", args[:2]); err != nil {
+		return err
+	}
+
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	}
+	err := each(args[0], func(e Object) Object {
+		if acc == nil {
+			acc = e
+		} else {
+			acc = rt.Call(args[1], acc, e)
+		}
+		return acc
+	})
+	if err != nil {
+		return err
+	}
+	return acc
+}
+
+// builtinSort returns a sorted copy of the array, or an array of the values
+// a generator yields, sorted. Without a comparator the elements must be all
+// integers or all strings. A comparator fn(a, b) returns true if a goes
+// before b.
+func builtinSort(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	elements, seqErr := sequence("sort", args[0])
+	if seqErr != nil {
+		return seqErr
+	}
+	sorted := make([]Object, len(elements))
+	copy(sorted, elements)
+
+	var err Object
+	var less func(a, b Object) bool
+	if len(args) == 2 {
+		less = func(a, b Object) bool {
+			result := rt.Call(args[1], a, b)
+			if isError(result) {
+				err = result
+				return false
+			}
+			return isTruthy(result)
+		}
+	} else {
+		less = func(a, b Object) bool {
+			switch {
+			case a.Type() == INTEGER_OBJ && b.Type() == INTEGER_OBJ:
+				return a.(*Integer).Value < b.(*Integer).Value
+			case a.Type() == STRING_OBJ && b.Type() == STRING_OBJ:
+				return a.(*String).Value < b.(*String).Value
+			default:
+				err = newError("cannot compare %s and %s, pass `sort` a comparator", a.Type(), b.Type())
+				return false
+			}
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return err == nil && less(sorted[i], sorted[j])
+	})
+	if err != nil {
+		return err
+	}
+	return &Array{Elements: sorted}
+}
+
+// builtinReverse returns a reversed copy of an array or string, or the
+// values a generator yields in reverse.
+func builtinReverse(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array, *Generator:
+		elements, err := sequence("reverse", arg)
+		if err != nil {
+			return err
+		}
+		length := len(elements)
+		reversed := make([]Object, length)
+		for i, e := range elements {
+			reversed[length-1-i] = e
+		}
+		return &Array{Elements: reversed}
+
+	case *String:
+		chars := []rune(arg.Value)
+		for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+			chars[i], chars[j] = chars[j], chars[i]
+		}
+		return &String{Value: string(chars)}
+
+	default:
+		return newError("argument to `reverse` must be ARRAY, GENERATOR or STRING, got %s", args[0].Type())
+	}
+}
+
+// builtinUniq returns the elements of an array, or the values a generator
+// yields, without those equal to an earlier one. Integers, strings and
+// booleans are looked up in a set, other values are compared with the
+// distinct ones kept so far.
+func builtinUniq(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	elements, err := sequence("uniq", args[0])
+	if err != nil {
+		return err
+	}
+
+	seen := map[HashKey]bool{}
+	var others []Object
+	result := []Object{}
+elements:
+	for _, e := range elements {
+		if h, ok := e.(Hashable); ok {
+			key := h.HashKey()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		} else {
+			for _, other := range others {
+				if Equal(e, other) {
+					continue elements
+				}
+			}
+			others = append(others, e)
+		}
+		result = append(result, e)
+	}
+	return &Array{Elements: result}
+}
+
+// builtinRange returns the integers from start (inclusive, defaults to 0) to
+// end (exclusive) advancing by step (defaults to 1).
+func builtinRange(rt Runtime, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+	bounds := make([]int64, len(args))
+	for i, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+		}
+		bounds[i] = integer.Value
+	}
+
+	start, end, step := int64(0), bounds[0], int64(1)
+	if len(bounds) > 1 {
+		start, end = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+	if step == 0 {
+		return newError("`range` step must not be 0")
+	}
+
+	result := []Object{}
+	for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+		result = append(result, &Integer{Value: i})
+	}
+	return &Array{Elements: result}
+}
+
+// builtinZip pairs up elements of the arrays and values of the generators,
+// stopping at the shortest one. Generators are only resumed as far as
+// needed, so they can be endless.
+func builtinZip(rt Runtime, args ...Object) Object {
+	if len(args) < 2 {
+		return newError("wrong number of arguments. got=%d, want at least 2", len(args))
+	}
+
+	iterators := make([]Iterator, len(args))
+	for i, arg := range args {
+		if arg.Type() != ARRAY_OBJ && arg.Type() != GENERATOR_OBJ {
+			return newError("argument to `zip` must be ARRAY or GENERATOR, got %s", arg.Type())
+		}
+		iterators[i], _ = Iterate(arg, true)
+	}
+
+	result := []Object{}
+	for {
+		tuple := make([]Object, len(args))
+		for i, it := range iterators {
+			_, value, err := it.Next()
+			if err != nil {
+				return newError("%s", err)
+			}
+			if value == nil {
+				return &Array{Elements: result}
+			}
+			tuple[i] = value
+		}
+		result = append(result, &Array{Elements: tuple})
+	}
+}
+
+func builtinAny(rt Runtime, args ...Object) Object {
+	if err := checkCallbackArgs("any", args); err != nil {
+		return err
+	}
+
+	found := FALSE
+	err := each(args[0], func(e Object) Object {
+		result := rt.Call(args[1], e)
+		if isTruthy(result) && !isError(result) {
+			found = TRUE
+			return nil
+		}
+		return result
+	})
+	if err != nil {
+		return err
+	}
+	return found
+}
+
+func builtinAll(rt Runtime, args ...Object) Object {
+	if err := checkCallbackArgs("all", args); err != nil {
+		return err
+	}
+
+	holds := TRUE
+	err := each(args[0], func(e Object) Object {
+		result := rt.Call(args[1], e)
+		if !isTruthy(result) {
+			holds = FALSE
+			return nil
+		}
+		return result
+	})
+	if err != nil {
+		return err
+	}
+	return holds
+}
+
+// each calls f with each element of an array, or each value a generator
+// yields, until f returns nil or an error, which each returns. Generators are
+// only resumed as far as needed, so any and all stop early on endless ones.
+func each(seq Object, f func(Object) Object) *Error {
+	if arr, ok := seq.(*Array); ok {
+		for _, e := range arr.Elements {
+			if result := f(e); result == nil || isError(result) {
+				err, _ := result.(*Error)
+				return err
+			}
+		}
+		return nil
+	}
+
+	g := seq.(*Generator)
+	for {
+		_, value, err := g.Next()
+		if err != nil {
+			return newError("%s", err)
+		}
+		if value == nil {
+			return nil
+		}
+		if result := f(value); result == nil || isError(result) {
+			err, _ := result.(*Error)
+			return err
+		}
+	}
+}
+
+// sequence returns the elements of an array, or all the values a generator
+// yields, for the builtin called name.
+func sequence(name string, arg Object) ([]Object, *Error) {
+	switch arg := arg.(type) {
+	case *Array:
+		return arg.Elements, nil
+	case *Generator:
+		values, err := arg.Take(-1)
+		if err != nil {
+			return nil, newError("%s", err)
+		}
+		return values, nil
+	default:
+		return nil, newError("argument to `%s` must be ARRAY or GENERATOR, got %s", name, arg.Type())
+	}
+}
+
+// checkCallbackArgs verifies the builtin called name got an array or a
+// generator and something callable.
+func checkCallbackArgs(name string, args []Object) *Error {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ && args[0].Type() != GENERATOR_OBJ {
+		return newError("argument to `%s` must be ARRAY or GENERATOR, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError("argument to `%s` must be a function, got %s", name, args[1].Type())
+	}
+	return nil
+}
+
+func isCallable(obj Object) bool {
+	switch obj.Type() {
+	case FUNCTION_OBJ, CLOSURE_OBJ, BUILTIN_OBJ, RECORD_TYPE_OBJ, BOUND_METHOD_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null, nil:
+		return false
+	default:
+		return true
+	}
+}
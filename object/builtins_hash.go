@@ -0,0 +1,104 @@
+package object
+
+func builtinKeys(rt Runtime, args ...Object) Object {
+	if err := checkArgs("keys", args, HASH_OBJ); err != nil {
+		return err
+	}
+
+	pairs := args[0].(*Hash).OrderedPairs()
+	keys := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+	return &Array{Elements: keys}
+}
+
+func builtinValues(rt Runtime, args ...Object) Object {
+	if err := checkArgs("values", args, HASH_OBJ); err != nil {
+		return err
+	}
+
+	pairs := args[0].(*Hash).OrderedPairs()
+	values := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		values[i] = pair.Value
+	}
+	return &Array{Elements: values}
+}
+
+// builtinHas reports whether the hash has the key, which tells a missing key
+// apart from one that's set to null.
+func builtinHas(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `has` must be HASH, got %s", args[0].Type())
+	}
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	_, ok = hash.Get(key.HashKey())
+	return nativeBoolToBoolean(ok)
+}
+
+// builtinDelete returns a copy of the hash without the key.
+func builtinDelete(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+	}
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	deleted := key.HashKey()
+	result := NewHash()
+	for _, pair := range hash.OrderedPairs() {
+		if k := pair.Key.(Hashable).HashKey(); k != deleted {
+			result.Set(k, pair)
+		}
+	}
+	return result
+}
+
+// builtinMerge returns a new hash with the pairs of all the hashes, later
+// hashes win when keys collide.
+func builtinMerge(rt Runtime, args ...Object) Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+
+	result := NewHash()
+	for _, arg := range args {
+		hash, ok := arg.(*Hash)
+		if !ok {
+			return newError("argument to `merge` must be HASH, got %s", arg.Type())
+		}
+		for _, pair := range hash.OrderedPairs() {
+			result.Set(pair.Key.(Hashable).HashKey(), pair)
+		}
+	}
+	return result
+}
+
+// builtinEntries returns the [key, value] pairs of the hash.
+func builtinEntries(rt Runtime, args ...Object) Object {
+	if err := checkArgs("entries", args, HASH_OBJ); err != nil {
+		return err
+	}
+
+	pairs := args[0].(*Hash).OrderedPairs()
+	entries := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		entries[i] = &Array{Elements: []Object{pair.Key, pair.Value}}
+	}
+	return &Array{Elements: entries}
+}
@@ -0,0 +1,73 @@
+package object
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// builtinPrint writes its arguments separated by spaces, without a newline.
+func builtinPrint(rt Runtime, args ...Object) Object {
+	fmt.Fprint(rt.Host().Stdout, joinInspected(args))
+	return nil
+}
+
+// builtinEprint is print for standard error.
+func builtinEprint(rt Runtime, args ...Object) Object {
+	fmt.Fprint(rt.Host().Stderr, joinInspected(args))
+	return nil
+}
+
+// builtinReadLine returns the next line of input, or null at the end of it.
+func builtinReadLine(rt Runtime, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	line, ok, err := rt.Host().ReadLine()
+	if err != nil {
+		return newError("reading input failed: %s", err)
+	}
+	if !ok {
+		return nil
+	}
+	return &String{Value: line}
+}
+
+func builtinReadFile(rt Runtime, args ...Object) Object {
+	if err := checkArgs("read_file", args, STRING_OBJ); err != nil {
+		return err
+	}
+	if !rt.Host().AllowFileSystem {
+		return newError("file system access is not allowed")
+	}
+
+	content, err := os.ReadFile(args[0].(*String).Value)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return &String{Value: string(content)}
+}
+
+func builtinWriteFile(rt Runtime, args ...Object) Object {
+	if err := checkArgs("write_file", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	if !rt.Host().AllowFileSystem {
+		return newError("file system access is not allowed")
+	}
+
+	err := os.WriteFile(args[0].(*String).Value, []byte(args[1].(*String).Value), 0644)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
+
+func joinInspected(args []Object) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Inspect()
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,182 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// builtinJSONParse decodes a JSON document. Objects become hashes keeping
+// the order of their keys, numbers become integers when they fit and floats
+// otherwise.
+func builtinJSONParse(rt Runtime, args ...Object) Object {
+	if err := checkArgs("json_parse", args, STRING_OBJ); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(args[0].(*String).Value))
+	dec.UseNumber()
+
+	value, err := decodeJSON(dec)
+	if err != nil {
+		return newError("invalid JSON: %s", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return newError("invalid JSON: unexpected data after top-level value")
+	}
+	return value
+}
+
+func decodeJSON(dec *json.Decoder) (Object, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			elements := []Object{}
+			for dec.More() {
+				e, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, e)
+			}
+			_, err := dec.Token() // closing ]
+			return &Array{Elements: elements}, err
+		}
+
+		hash := NewHash()
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := &String{Value: keyTok.(string)}
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+		}
+		_, err := dec.Token() // closing }
+		return hash, err
+
+	case string:
+		return &String{Value: tok}, nil
+
+	case json.Number:
+		if i, err := tok.Int64(); err == nil {
+			return &Integer{Value: i}, nil
+		}
+		f, err := tok.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &Float{Value: f}, nil
+
+	case bool:
+		return nativeBoolToBoolean(tok), nil
+
+	default: // nil
+		return NULL, nil
+	}
+}
+
+// builtinJSONStringify encodes a value as JSON. Hash keys are written in
+// insertion order. The optional indent is a number of spaces or a string.
+func builtinJSONStringify(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *Integer:
+			indent = strings.Repeat(" ", int(clamp(arg.Value, 0, 10)))
+		case *String:
+			indent = arg.Value
+		default:
+			return newError("indent to `json_stringify` must be INTEGER or STRING, got %s", arg.Type())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := encodeJSON(&out, args[0]); err != nil {
+		return newError("%s", err)
+	}
+
+	if indent != "" {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, out.Bytes(), "", indent); err != nil {
+			return newError("%s", err)
+		}
+		return &String{Value: indented.String()}
+	}
+	return &String{Value: out.String()}
+}
+
+func encodeJSON(out *bytes.Buffer, obj Object) error {
+	switch obj := obj.(type) {
+	case *Null:
+		out.WriteString("null")
+
+	case *Boolean, *Integer:
+		out.WriteString(obj.Inspect())
+
+	case *Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return fmt.Errorf("cannot encode %s as JSON", obj.Inspect())
+		}
+		out.WriteString(obj.Inspect())
+
+	case *String:
+		encodeJSONString(out, obj.Value)
+
+	case *Array:
+		out.WriteString("[")
+		for i, e := range obj.Elements {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			if err := encodeJSON(out, e); err != nil {
+				return err
+			}
+		}
+		out.WriteString("]")
+
+	case *Hash:
+		out.WriteString("{")
+		for i, pair := range obj.OrderedPairs() {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			// JSON only has string keys, integer and boolean keys are
+			// written as their string form
+			encodeJSONString(out, pair.Key.Inspect())
+			out.WriteString(":")
+			if err := encodeJSON(out, pair.Value); err != nil {
+				return err
+			}
+		}
+		out.WriteString("}")
+
+	default:
+		return fmt.Errorf("cannot encode %s as JSON", obj.Type())
+	}
+
+	return nil
+}
+
+func encodeJSONString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	out.Truncate(out.Len() - 1) // Encode terminates with a newline
+}
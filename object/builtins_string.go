@@ -0,0 +1,209 @@
+package object
+
+import "strings"
+
+func builtinSplit(rt Runtime, args ...Object) Object {
+	if err := checkArgs("split", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+
+	parts := strings.Split(args[0].(*String).Value, args[1].(*String).Value)
+	elements := make([]Object, len(parts))
+	for i, p := range parts {
+		elements[i] = &String{Value: p}
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinJoin(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ && args[0].Type() != GENERATOR_OBJ {
+		return newError("argument to `join` must be ARRAY or GENERATOR, got %s", args[0].Type())
+	}
+	if args[1].Type() != STRING_OBJ {
+		return newError("argument to `join` must be STRING, got %s", args[1].Type())
+	}
+
+	parts := []string{}
+	err := each(args[0], func(e Object) Object {
+		parts = append(parts, e.Inspect())
+		return e
+	})
+	if err != nil {
+		return err
+	}
+	return &String{Value: strings.Join(parts, args[1].(*String).Value)}
+}
+
+func builtinTrim(rt Runtime, args ...Object) Object {
+	if err := checkArgs("trim", args, STRING_OBJ); err != nil {
+		return err
+	}
+	return &String{Value: strings.TrimSpace(args[0].(*String).Value)}
+}
+
+func builtinUpper(rt Runtime, args ...Object) Object {
+	if err := checkArgs("upper", args, STRING_OBJ); err != nil {
+		return err
+	}
+	return &String{Value: strings.ToUpper(args[0].(*String).Value)}
+}
+
+func builtinLower(rt Runtime, args ...Object) Object {
+	if err := checkArgs("lower", args, STRING_OBJ); err != nil {
+		return err
+	}
+	return &String{Value: strings.ToLower(args[0].(*String).Value)}
+}
+
+func builtinContains(rt Runtime, args ...Object) Object {
+	if err := checkArgs("contains", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	return nativeBoolToBoolean(strings.Contains(args[0].(*String).Value, args[1].(*String).Value))
+}
+
+func builtinReplace(rt Runtime, args ...Object) Object {
+	if err := checkArgs("replace", args, STRING_OBJ, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+
+	s := args[0].(*String).Value
+	from := args[1].(*String).Value
+	to := args[2].(*String).Value
+	return &String{Value: strings.ReplaceAll(s, from, to)}
+}
+
+// builtinIndexOf returns the position of the first occurrence of the substring
+// counted in characters, or -1 if there's none.
+func builtinIndexOf(rt Runtime, args ...Object) Object {
+	if err := checkArgs("index_of", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+
+	s := args[0].(*String).Value
+	idx := strings.Index(s, args[1].(*String).Value)
+	if idx < 0 {
+		return &Integer{Value: -1}
+	}
+	return &Integer{Value: int64(len([]rune(s[:idx])))}
+}
+
+// builtinSubstr returns the characters between start (inclusive) and end
+// (exclusive). The end defaults to the length of the string and both bounds are
+// clamped to it.
+func builtinSubstr(rt Runtime, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	if args[0].Type() != STRING_OBJ {
+		return newError("argument to `substr` must be STRING, got %s", args[0].Type())
+	}
+	for _, arg := range args[1:] {
+		if arg.Type() != INTEGER_OBJ {
+			return newError("argument to `substr` must be INTEGER, got %s", arg.Type())
+		}
+	}
+
+	chars := []rune(args[0].(*String).Value)
+	length := int64(len(chars))
+
+	start := clamp(args[1].(*Integer).Value, 0, length)
+	end := length
+	if len(args) == 3 {
+		end = clamp(args[2].(*Integer).Value, start, length)
+	}
+
+	return &String{Value: string(chars[start:end])}
+}
+
+func builtinStartsWith(rt Runtime, args ...Object) Object {
+	if err := checkArgs("starts_with", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	return nativeBoolToBoolean(strings.HasPrefix(args[0].(*String).Value, args[1].(*String).Value))
+}
+
+func builtinEndsWith(rt Runtime, args ...Object) Object {
+	if err := checkArgs("ends_with", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	return nativeBoolToBoolean(strings.HasSuffix(args[0].(*String).Value, args[1].(*String).Value))
+}
+
+func builtinRepeat(rt Runtime, args ...Object) Object {
+	if err := checkArgs("repeat", args, STRING_OBJ, INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	count := args[1].(*Integer).Value
+	if count < 0 {
+		return newError("negative repeat count: %d", count)
+	}
+	return &String{Value: strings.Repeat(args[0].(*String).Value, int(count))}
+}
+
+func builtinChars(rt Runtime, args ...Object) Object {
+	if err := checkArgs("chars", args, STRING_OBJ); err != nil {
+		return err
+	}
+
+	chars := []rune(args[0].(*String).Value)
+	elements := make([]Object, len(chars))
+	for i, ch := range chars {
+		elements[i] = &String{Value: string(ch)}
+	}
+	return &Array{Elements: elements}
+}
+
+// builtinFormat replaces each `{}` in the format string with the next argument,
+// e.g. format("{} + {}", 1, 2) gives "1 + 2".
+func builtinFormat(rt Runtime, args ...Object) Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+	if args[0].Type() != STRING_OBJ {
+		return newError("argument to `format` must be STRING, got %s", args[0].Type())
+	}
+
+	parts := strings.Split(args[0].(*String).Value, "{}")
+	values := args[1:]
+	if len(parts)-1 != len(values) {
+		return newError("wrong number of values for format string. got=%d, want=%d", len(values), len(parts)-1)
+	}
+
+	var out strings.Builder
+	for i, p := range parts {
+		out.WriteString(p)
+		if i < len(values) {
+			out.WriteString(values[i].Inspect())
+		}
+	}
+	return &String{Value: out.String()}
+}
+
+// builtinBytes returns the raw UTF-8 bytes of the string as integers.
+func builtinBytes(rt Runtime, args ...Object) Object {
+	if err := checkArgs("bytes", args, STRING_OBJ); err != nil {
+		return err
+	}
+
+	s := args[0].(*String).Value
+	elements := make([]Object, len(s))
+	for i := 0; i < len(s); i++ {
+		elements[i] = &Integer{Value: int64(s[i])}
+	}
+	return &Array{Elements: elements}
+}
+
+func clamp(v, min, max int64) int64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
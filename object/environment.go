@@ -3,12 +3,34 @@ package object
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	host  *Host
+	base  *Environment // what a top-level environment started out from
 }
 
 func NewEnvironment() *Environment {
 	return &Environment{store: map[string]Object{}}
 }
 
+// NewEnvironmentWithHost creates a top-level environment whose programs do
+// their I/O through host.
+func NewEnvironmentWithHost(host *Host) *Environment {
+	env := NewEnvironment()
+	env.host = host
+	return env
+}
+
+// NewEnvironmentFrom creates a top-level environment which starts out with
+// the names defined in base, e.g. a prelude. Modules imported by the program
+// see them too.
+func NewEnvironmentFrom(base *Environment, host *Host) *Environment {
+	env := NewEnvironmentWithHost(host)
+	for name, val := range base.store {
+		env.store[name] = val
+	}
+	env.base = base
+	return env
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return &Environment{store: map[string]Object{}, outer: outer}
 }
@@ -25,3 +47,27 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Outermost returns the top-level environment e is enclosed in, or e itself
+// if it's one.
+func (e *Environment) Outermost() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// Base returns the environment the program env belongs to started out from,
+// or nil if it started out empty.
+func (e *Environment) Base() *Environment {
+	return e.Outermost().base
+}
+
+// Host returns the host of the outermost environment, or the default one if
+// none was given.
+func (e *Environment) Host() *Host {
+	if host := e.Outermost().host; host != nil {
+		return host
+	}
+	return DefaultHost()
+}
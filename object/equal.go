@@ -0,0 +1,71 @@
+package object
+
+// Equal reports whether a and b are structurally equal: scalars compare by
+// value, arrays, hashes and records of the same type compare element by
+// element, and everything else (functions, closures, builtins...) compares
+// by identity.
+func Equal(a, b Object) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+
+	case *Float:
+		return a.Value == b.(*Float).Value
+
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+
+	case *String:
+		return a.Value == b.(*String).Value
+
+	case *Null:
+		return true
+
+	case *Array:
+		other := b.(*Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *Hash:
+		other := b.(*Hash)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !Equal(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+
+	case *Record:
+		other := b.(*Record)
+		if a.RecordType != other.RecordType {
+			return false
+		}
+		for i := range a.Fields {
+			if !Equal(a.Fields[i], other.Fields[i]) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,85 @@
+package object
+
+import "fmt"
+
+// Generator is what calling a function that yields returns. The function
+// runs up to its next yield each time a value is asked for, resumed by the
+// engine that created the generator.
+type Generator struct {
+	// resume runs the function up to its next yield and returns the value
+	// yielded, or nil once the function has returned
+	resume  func() (Object, error)
+	done    bool
+	running bool
+	pos     int64
+}
+
+// NewGenerator returns a generator resumed by resume, which returns the
+// next value yielded or nil once the function has returned.
+func NewGenerator(resume func() (Object, error)) *Generator {
+	return &Generator{resume: resume}
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+// Next implements Iterator, the keys count the values yielded from 0. Once
+// the function has returned or failed the generator stays done.
+func (g *Generator) Next() (Object, Object, error) {
+	if g.done {
+		return nil, nil, nil
+	}
+	if g.running {
+		return nil, nil, fmt.Errorf("generator is already running")
+	}
+
+	g.running = true
+	value, err := g.resume()
+	g.running = false
+	if err != nil || value == nil {
+		g.done = true
+		return nil, nil, err
+	}
+
+	key := &Integer{Value: g.pos}
+	g.pos++
+	return key, value, nil
+}
+
+// Take returns the next values the generator yields, at most n of them or
+// all of them if n is negative.
+func (g *Generator) Take(n int) ([]Object, error) {
+	values := []Object{}
+	for n < 0 || len(values) < n {
+		_, value, err := g.Next()
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			break
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// method returns the method of the generator called name: next, which
+// resumes it and returns the value yielded, or null once it's done.
+func (g *Generator) method(name string) (Object, bool) {
+	if name != "next" {
+		return nil, false
+	}
+	return &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		_, value, err := g.Next()
+		if err != nil {
+			return newError("%s", err)
+		}
+		if value == nil {
+			return NULL
+		}
+		return value
+	}}, true
+}
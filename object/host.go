@@ -0,0 +1,64 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Host is the outside world as seen by a running program: where its input
+// comes from, where its output goes and what else it may touch. Each VM and
+// evaluator environment runs against one.
+type Host struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// AllowFileSystem permits read_file and write_file. It's off unless the
+	// embedder explicitly grants it.
+	AllowFileSystem bool
+
+	stdin *bufio.Reader // buffers Stdin across read_line calls
+}
+
+func NewHost(stdin io.Reader, stdout, stderr io.Writer) *Host {
+	return &Host{Stdin: stdin, Stdout: stdout, Stderr: stderr}
+}
+
+// defaultHost buffers the standard input up front, so the copies handed out
+// share the buffer and with it what was read ahead.
+var defaultHost = &Host{
+	Stdin:  os.Stdin,
+	Stdout: os.Stdout,
+	Stderr: os.Stderr,
+	stdin:  bufio.NewReader(os.Stdin),
+}
+
+// DefaultHost returns a host backed by the process' standard streams, with
+// no file system access. Each call returns a fresh copy, so granting a copy
+// permissions doesn't affect the others.
+func DefaultHost() *Host {
+	h := *defaultHost
+	return &h
+}
+
+// ReadLine reads the next line from Stdin without its line ending. It
+// reports false once the input is exhausted.
+func (h *Host) ReadLine() (string, bool, error) {
+	if h.stdin == nil {
+		// reuses Stdin as is when it's already a *bufio.Reader, so the host
+		// can share buffered input with its embedder
+		h.stdin = bufio.NewReader(h.Stdin)
+	}
+
+	line, err := h.stdin.ReadString('\n')
+	if err == io.EOF {
+		return line, line != "", nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return strings.TrimRight(line, "\r\n"), true, nil
+}
@@ -0,0 +1,103 @@
+package object
+
+import "fmt"
+
+// Iterator steps through the elements of the value a for loop runs over.
+type Iterator interface {
+	Object
+	// Next returns the key and value of the next element, the value is nil
+	// once there are none left.
+	Next() (key, value Object, err error)
+}
+
+// Iterate returns an iterator over value. Arrays yield their indexes and
+// elements, strings their indexes and characters, hashes their keys and
+// values in insertion order, and generators are iterators themselves. A loop
+// with a single variable binds the value, except for hashes where it's the
+// key, so with single set hashes yield their keys as values.
+func Iterate(value Object, single bool) (Iterator, error) {
+	switch value := value.(type) {
+	case Iterator:
+		return value, nil
+
+	case *Array:
+		return &sliceIterator{elements: value.Elements}, nil
+
+	case *String:
+		chars := []rune(value.Value)
+		elements := make([]Object, len(chars))
+		for i, ch := range chars {
+			elements[i] = &String{Value: string(ch)}
+		}
+		return &sliceIterator{elements: elements}, nil
+
+	case *Hash:
+		return &hashIterator{pairs: value.OrderedPairs(), single: single}, nil
+
+	default:
+		return nil, fmt.Errorf("cannot iterate over %s", value.Type())
+	}
+}
+
+// DestructureArray returns the array an array pattern with n elements takes
+// apart. Generators are resumed for the n values the pattern binds, or to the
+// end if rest is set as its rest binds the others too.
+func DestructureArray(value Object, n int, rest bool) (*Array, error) {
+	switch value := value.(type) {
+	case *Array:
+		return value, nil
+
+	case *Generator:
+		if rest {
+			n = -1
+		}
+		values, err := value.Take(n)
+		if err != nil {
+			return nil, err
+		}
+		return &Array{Elements: values}, nil
+
+	default:
+		return nil, fmt.Errorf("cannot destructure %s as %s", value.Type(), ARRAY_OBJ)
+	}
+}
+
+// sliceIterator iterates over the elements of arrays and characters of
+// strings.
+type sliceIterator struct {
+	elements []Object
+	pos      int
+}
+
+func (it *sliceIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *sliceIterator) Inspect() string  { return "iterator" }
+
+func (it *sliceIterator) Next() (Object, Object, error) {
+	if it.pos >= len(it.elements) {
+		return nil, nil, nil
+	}
+	key := &Integer{Value: int64(it.pos)}
+	it.pos++
+	return key, it.elements[it.pos-1], nil
+}
+
+type hashIterator struct {
+	pairs  []HashPair
+	pos    int
+	single bool
+}
+
+func (it *hashIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *hashIterator) Inspect() string  { return "iterator" }
+
+func (it *hashIterator) Next() (Object, Object, error) {
+	if it.pos >= len(it.pairs) {
+		return nil, nil, nil
+	}
+	pair := it.pairs[it.pos]
+	it.pos++
+	if it.single {
+		return pair.Key, pair.Key, nil
+	}
+	return pair.Key, pair.Value, nil
+}
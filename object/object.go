@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"strconv"
+	"strings"
 
 	"monkey/ast"
 	"monkey/code"
@@ -13,6 +15,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ           ObjectType = "INTEGER"
+	FLOAT_OBJ             ObjectType = "FLOAT"
 	BOOLEAN_OBJ           ObjectType = "BOOLEAN"
 	STRING_OBJ            ObjectType = "STRING"
 	NULL_OBJ              ObjectType = "NULL"
@@ -26,6 +29,19 @@ const (
 	HASH_OBJ              ObjectType = "HASH"
 	QUOTE_OBJ             ObjectType = "QUOTE"
 	MACRO_OBJ             ObjectType = "MACRO"
+	RECORD_TYPE_OBJ       ObjectType = "STRUCT"
+	RECORD_OBJ            ObjectType = "RECORD"
+	BOUND_METHOD_OBJ      ObjectType = "BOUND_METHOD"
+	ITERATOR_OBJ          ObjectType = "ITERATOR"
+	GENERATOR_OBJ         ObjectType = "GENERATOR"
+)
+
+// Canonical instances shared by both engines and the builtins, so that
+// truthiness and identity checks work no matter who created the value.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
 )
 
 type Object interface {
@@ -40,6 +56,22 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// Float has no literal syntax yet, it's produced by builtins such as
+// json_parse.
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		// keep whole floats recognisable as such
+		s += ".0"
+	}
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -74,9 +106,13 @@ func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 type Function struct {
-	Params []*ast.Identifier
-	Body   *ast.BlockStatement
-	Env    *Environment
+	Params    []*ast.Identifier
+	Patterns  []ast.Pattern // see ast.FunctionLiteral.ParamPatterns
+	Defaults  []Object      // values of the trailing parameters with a default
+	Variadic  bool
+	Generator bool // calling it returns a generator, see ast.FunctionLiteral
+	Body      *ast.BlockStatement
+	Env       *Environment
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -84,6 +120,9 @@ func (f *Function) Inspect() string {
 	var out bytes.Buffer
 	out.WriteString("fn(")
 	for i, p := range f.Params {
+		if f.Variadic && i == len(f.Params)-1 {
+			out.WriteString("...")
+		}
 		out.WriteString(p.String())
 		if i < len(f.Params)-1 {
 			out.WriteString(", ")
@@ -99,12 +138,26 @@ type CompiledFunction struct {
 	Instructions code.Instructions
 	NumLocals    int
 	NumParams    int
+	NumDefaults  int  // trailing parameters with a default, see Closure.Defaults
+	Variadic     bool // the last parameter collects the extra arguments
+	Generator    bool // calling it returns a generator
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
 func (cf *CompiledFunction) Inspect() string  { return fmt.Sprintf("CompiledFunction[%p]", cf) }
 
-type BuiltinFunction func(args ...Object) Object
+// Runtime is the engine a builtin is executed by. It lets builtins call
+// back into the functions they were given as arguments.
+type Runtime interface {
+	// Call applies fn to args and returns the result. It returns an *Error if
+	// fn isn't callable or fails.
+	Call(fn Object, args ...Object) Object
+
+	// Host is where the program does its I/O.
+	Host() *Host
+}
+
+type BuiltinFunction func(rt Runtime, args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
@@ -138,8 +191,9 @@ func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
 type Closure struct {
-	Fn   *CompiledFunction
-	Free []Object
+	Fn       *CompiledFunction
+	Free     []Object
+	Defaults []Object // evaluated when the closure was created
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
@@ -199,18 +253,47 @@ type HashPair struct {
 
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	keys  []HashKey // insertion order of Pairs
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+// Set adds the pair under the given key. Overwriting an existing key keeps
+// its original position.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.keys = append(h.keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+func (h *Hash) Get(key HashKey) (HashPair, bool) {
+	pair, ok := h.Pairs[key]
+	return pair, ok
+}
+
+func (h *Hash) Len() int { return len(h.Pairs) }
+
+// OrderedPairs returns the pairs in the order they were inserted.
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.keys))
+	for _, k := range h.keys {
+		pairs = append(pairs, h.Pairs[k])
+	}
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 	out.WriteString("{")
-	for _, pair := range h.Pairs {
+	for i, pair := range h.OrderedPairs() {
 		out.WriteString(fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
-		// TODO remove last comma
-		// if i < len(h.Pairs)-1 {
-		// 	out.WriteString(", ")
-		// }
+		if i < len(h.keys)-1 {
+			out.WriteString(", ")
+		}
 	}
 	out.WriteString("}")
 	return out.String()
@@ -35,3 +35,69 @@ func TestIntHashKey(t *testing.T) {
 		t.Errorf("integers with different value have same hash keys")
 	}
 }
+
+func TestHashInspectKeepsInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	for _, k := range []string{"zebra", "apple", "mango"} {
+		key := &String{Value: k}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: int64(len(k))}})
+	}
+	// overwriting keeps the original position
+	key := &String{Value: "zebra"}
+	hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: 0}})
+
+	expected := "{zebra: 0, apple: 5, mango: 5}"
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. want=%q, got=%q", expected, hash.Inspect())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	newHash := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable).HashKey(), HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	a, b := &String{Value: "a"}, &String{Value: "b"}
+	fn := &Builtin{}
+
+	tests := []struct {
+		left, right Object
+		expected    bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, two, false},
+		{a, &String{Value: "a"}, true},
+		{one, a, false},
+		{&Null{}, &Null{}, true},
+		{&Array{Elements: []Object{one, a}}, &Array{Elements: []Object{one, a}}, true},
+		{&Array{Elements: []Object{one, a}}, &Array{Elements: []Object{a, one}}, false},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{one, one}}, false},
+		{newHash(a, one, b, two), newHash(b, two, a, one), true},
+		{newHash(a, one), newHash(a, two), false},
+		{newHash(a, one), newHash(b, one), false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Equal(tt.left, tt.right); got != tt.expected {
+			t.Errorf("Equal(%s, %s) wrong. want=%t, got=%t", tt.left.Inspect(), tt.right.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestDefaultHostIsNotShared(t *testing.T) {
+	granted := DefaultHost()
+	granted.AllowFileSystem = true
+
+	if DefaultHost().AllowFileSystem {
+		t.Errorf("permission granted to one default host leaked into later ones")
+	}
+	if granted.stdin != DefaultHost().stdin {
+		t.Errorf("default hosts don't share the buffered standard input")
+	}
+}
@@ -0,0 +1,106 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RecordType is a type declared with struct. Calling it creates a record
+// with the arguments as the values of its fields.
+type RecordType struct {
+	Name    string
+	Fields  []string
+	Methods map[string]Object // take the record they're called on first
+}
+
+func (rt *RecordType) Type() ObjectType { return RECORD_TYPE_OBJ }
+func (rt *RecordType) Inspect() string  { return "struct " + rt.Name }
+
+// New returns a record of the type with the given field values.
+func (rt *RecordType) New(args []Object) (*Record, error) {
+	values, err := BindArgs(len(rt.Fields), nil, false, args)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]Object, len(values))
+	copy(fields, values)
+	return &Record{RecordType: rt, Fields: fields}, nil
+}
+
+// Record is a value of a record type, Fields holds the value of each field
+// of the type in order.
+type Record struct {
+	RecordType *RecordType
+	Fields     []Object
+}
+
+func (r *Record) Type() ObjectType { return RECORD_OBJ }
+func (r *Record) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString(r.RecordType.Name + "{")
+	for i, name := range r.RecordType.Fields {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(name + ": " + r.Fields[i].Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// BoundMethod is a method of a record taken as a value, as in p.norm.
+// Calling it calls the method with the record as the first argument.
+type BoundMethod struct {
+	Receiver *Record
+	Method   Object
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string  { return bm.Receiver.RecordType.Name + " method" }
+
+// GetField returns the field or, bound to the record, the method of value
+// called name. Generators have a next method.
+func GetField(value Object, name string) (Object, error) {
+	if g, ok := value.(*Generator); ok {
+		if method, ok := g.method(name); ok {
+			return method, nil
+		}
+		return nil, fmt.Errorf("%s has no field or method %s", g.Type(), name)
+	}
+
+	record, ok := value.(*Record)
+	if !ok {
+		return nil, fmt.Errorf("field access not supported: %s", value.Type())
+	}
+
+	for i, field := range record.RecordType.Fields {
+		if field == name {
+			return record.Fields[i], nil
+		}
+	}
+	if method, ok := record.RecordType.Methods[name]; ok {
+		return &BoundMethod{Receiver: record, Method: method}, nil
+	}
+	return nil, fmt.Errorf("%s has no field or method %s", record.RecordType.Name, name)
+}
+
+// TypeName is what the type builtin reports for value: the name of its
+// record type for records, FUNCTION for functions of either engine, builtins
+// and bound methods, and the object type otherwise.
+func TypeName(value Object) string {
+	switch value := value.(type) {
+	case *Record:
+		return value.RecordType.Name
+	case *Function, *Closure, *Builtin, *BoundMethod:
+		return string(FUNCTION_OBJ)
+	default:
+		return string(value.Type())
+	}
+}
+
+func builtinType(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	return &String{Value: TypeName(args[0])}
+}
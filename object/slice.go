@@ -0,0 +1,61 @@
+package object
+
+import "fmt"
+
+// Slice returns the elements of an array or the characters of a string
+// between start (inclusive) and end (exclusive). Either bound may be NULL to
+// slice from the beginning or to the end, negative bounds count from the end
+// and bounds out of range are clamped.
+func Slice(left, start, end Object) (Object, error) {
+	switch left := left.(type) {
+	case *Array:
+		from, to, err := sliceBounds(int64(len(left.Elements)), start, end)
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]Object, to-from)
+		copy(elements, left.Elements[from:to])
+		return &Array{Elements: elements}, nil
+
+	case *String:
+		chars := []rune(left.Value)
+		from, to, err := sliceBounds(int64(len(chars)), start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &String{Value: string(chars[from:to])}, nil
+
+	default:
+		return nil, fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+}
+
+func sliceBounds(length int64, start, end Object) (int64, int64, error) {
+	from, err := sliceBound(length, start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := sliceBound(length, end, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		to = from
+	}
+	return from, to, nil
+}
+
+func sliceBound(length int64, bound Object, def int64) (int64, error) {
+	switch bound := bound.(type) {
+	case *Null:
+		return def, nil
+	case *Integer:
+		i := bound.Value
+		if i < 0 {
+			i += length
+		}
+		return clamp(i, 0, length), nil
+	default:
+		return 0, fmt.Errorf("slice bound must be INTEGER, got %s", bound.Type())
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"monkey/ast"
 	"monkey/lexer"
@@ -18,14 +19,25 @@ const (
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
-	INDEX       // array[index]
+	INDEX       // array[index] or record.field
 )
 
 type Parser struct {
 	l         *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []Error
+
+	// panicking is set by the first error of a statement, further errors
+	// are likely a cascade and dropped until the parser resynchronizes
+	panicking bool
+	// depth is the number of braces opened and not closed yet, up to and
+	// including curToken
+	depth int
+
+	// functions are the function literals being parsed, innermost last, nil
+	// for macros
+	functions []*ast.FunctionLiteral
 
 	prefixParseFns map[token.Type]prefixParseFn
 	infixParseFns  map[token.Type]infixParseFn
@@ -47,6 +59,7 @@ var precedences = map[token.Type]int{
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -62,14 +75,18 @@ func New(l *lexer.Lexer) *Parser {
 		token.FALSE:    p.parseBoolean,
 		token.INT:      p.parseIntegerLiteral,
 		token.STRING:   p.parseStringLiteral,
+		token.TEMPLATE: p.parseInterpolatedString,
 		token.FUNCTION: p.parseFunctionLiteral,
 		token.MACRO:    p.parseMacroLiteral,
+		token.IMPORT:   p.parseImportExpression,
 		token.LBRACKET: p.parseArrayLiteral,
 		token.LBRACE:   p.parseHashLiteral,
 		token.BANG:     p.parsePrefixExpression,
 		token.MINUS:    p.parsePrefixExpression,
 		token.LPAREN:   p.parseGroupedExpression,
 		token.IF:       p.parseIfExpression,
+		token.MATCH:    p.parseMatchExpression,
+		token.ILLEGAL:  p.parseIllegal,
 	}
 
 	p.infixParseFns = map[token.Type]infixParseFn{
@@ -83,15 +100,69 @@ func New(l *lexer.Lexer) *Parser {
 		token.GT:       p.parseInfixExpression,
 		token.LPAREN:   p.parseCallExpression,
 		token.LBRACKET: p.parseIndexExpression,
+		token.DOT:      p.parseFieldExpression,
 	}
 
 	return p
 }
 
+// ErrorKind classifies syntax errors.
+type ErrorKind string
+
+const (
+	UnexpectedToken     ErrorKind = "unexpected token"
+	MissingExpression   ErrorKind = "missing expression"
+	MissingType         ErrorKind = "missing type"
+	MissingPattern      ErrorKind = "missing pattern"
+	MissingDefault      ErrorKind = "missing default"
+	MissingReceiver     ErrorKind = "missing receiver"
+	DuplicateName       ErrorKind = "duplicate name"
+	MisplacedYield      ErrorKind = "misplaced yield"
+	InvalidInteger      ErrorKind = "invalid integer"
+	IllegalCharacter    ErrorKind = "illegal character"
+	UnterminatedString  ErrorKind = "unterminated string"
+	InvalidEscape       ErrorKind = "invalid escape"
+	UnterminatedComment ErrorKind = "unterminated comment"
+)
+
+// Error is a syntax error, positioned at the token it was found at.
+// Expected is only set for UnexpectedToken errors raised where a single
+// token type would have been valid.
+type Error struct {
+	Kind     ErrorKind
+	Message  string
+	Expected token.Type
+	Found    token.Token
+	Line     int
+	Column   int
+}
+
+// Errors returns the messages of the errors found so far.
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Message
+	}
+	return msgs
+}
+
+// PositionedErrors returns the errors found so far along with their positions.
+func (p *Parser) PositionedErrors() []Error {
 	return p.errors
 }
 
+func (p *Parser) errorAt(kind ErrorKind, tok token.Token, format string, a ...interface{}) {
+	p.addError(Error{Kind: kind, Message: fmt.Sprintf(format, a...), Found: tok, Line: tok.Line, Column: tok.Column})
+}
+
+func (p *Parser) addError(err Error) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, err)
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 
@@ -107,7 +178,11 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	p.depth += braceDepth(p.curToken.Type)
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 func (p *Parser) expectPeek(typ token.Type) bool {
@@ -116,11 +191,26 @@ func (p *Parser) expectPeek(typ token.Type) bool {
 		return true
 	}
 
-	msg := fmt.Sprintf("expected next token to be %s, got %s", typ, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(Error{
+		Kind:     UnexpectedToken,
+		Message:  fmt.Sprintf("expected next token to be %s, got %s", typ, p.peekToken.Type),
+		Expected: typ,
+		Found:    p.peekToken,
+		Line:     p.peekToken.Line,
+		Column:   p.peekToken.Column,
+	})
 	return false
 }
 
+// Precedence returns how tightly the infix operator binds, higher binds
+// tighter. It's LOWEST for tokens that aren't infix operators.
+func Precedence(typ token.Type) int {
+	if prec, ok := precedences[typ]; ok {
+		return prec
+	}
+	return LOWEST
+}
+
 func (p *Parser) peekPrecedence() int {
 	if prec, ok := precedences[p.peekToken.Type]; ok {
 		return prec
@@ -151,8 +241,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	v, err := strconv.ParseInt(il.Token.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not pase %q as int64", il.Token.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(InvalidInteger, il.Token, "could not pase %q as int64", il.Token.Literal)
 		return nil
 	}
 
@@ -164,25 +253,164 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseInterpolatedString parses each `${...}` of the template with its own
+// parser, the text in between becomes string literals.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	is := &ast.InterpolatedString{Token: p.curToken}
+
+	for _, part := range lexer.SplitTemplate(p.curToken.Literal) {
+		if !part.IsExpr {
+			if part.Text != "" {
+				t := token.Token{Type: token.STRING, Literal: part.Text, Line: p.curToken.Line, Column: p.curToken.Column}
+				is.Parts = append(is.Parts, &ast.StringLiteral{Token: t, Value: part.Text})
+			}
+			continue
+		}
+
+		sub := New(lexer.New(part.Text))
+		exp := sub.parseExpression(LOWEST)
+		if sub.peekToken.Type != token.EOF {
+			sub.errorAt(UnexpectedToken, sub.peekToken, "unexpected %s in string interpolation", sub.peekToken.Type)
+		}
+		if len(sub.errors) > 0 {
+			// positions within the template aren't known, report the
+			// errors at the string itself
+			for _, err := range sub.errors {
+				p.errorAt(err.Kind, p.curToken, "%s", err.Message)
+			}
+			return nil
+		}
+
+		is.Parts = append(is.Parts, exp)
+	}
+
+	return is
+}
+
+// parseIllegal reports the illegal token the lexer gave up on.
+func (p *Parser) parseIllegal() ast.Expression {
+	lit := p.curToken.Literal
+
+	switch {
+	case strings.HasPrefix(lit, `"`) || strings.HasPrefix(lit, "`"):
+		p.errorAt(UnterminatedString, p.curToken, "unterminated string literal %s", lit)
+	case strings.HasPrefix(lit, `\`):
+		p.errorAt(InvalidEscape, p.curToken, "invalid escape sequence %s", lit)
+	case strings.HasPrefix(lit, "/*"):
+		p.errorAt(UnterminatedComment, p.curToken, "unterminated comment")
+	default:
+		p.errorAt(IllegalCharacter, p.curToken, "illegal character %q", lit)
+	}
+	return nil
+}
+
+// parseStatement parses a statement, or returns nil if it had errors. A
+// statement with errors is dropped as a whole so no nil node reaches later
+// stages, and the parser skips to where the next statement likely starts.
+// Errors within nested blocks only drop the statements they were found in.
 func (p *Parser) parseStatement() ast.Statement {
+	// the depth the statement starts at, before its first token
+	base := p.depth - braceDepth(p.curToken.Type)
+
+	if p.panicking {
+		// the enclosing statement is broken and gets dropped with this one
+		p.skipStatement(base)
+		return nil
+	}
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
+	case token.STRUCT:
+		// an invalid struct, e.g. one with a duplicate field, comes back
+		// nil with its error recorded but without panicking, since the
+		// parser is already past its `}`; syntax errors panic and are
+		// skipped below. The check keeps a typed nil out of stmt.
+		if ss := p.parseStructStatement(); ss != nil {
+			stmt = ss
+		}
+	case token.FOR:
+		stmt = p.parseForStatement()
+	case token.YIELD:
+		stmt = p.parseYieldStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
+	}
+
+	if p.panicking {
+		p.skipStatement(base)
+		p.panicking = false
+		return nil
+	}
+	return stmt
+}
+
+// statementKeywords start statements, the parser resynchronizes before them.
+var statementKeywords = map[token.Type]bool{
+	token.LET:    true,
+	token.RETURN: true,
+	token.STRUCT: true,
+	token.FOR:    true,
+	token.YIELD:  true,
+}
+
+// skipStatement skips the rest of a broken statement which started at the
+// brace depth base. It stops on its `;`, or before a `}` or statement
+// keyword that isn't nested within braces the statement opened, counting
+// those it opened before the error too. It stops on an unmatched `}` as
+// well, which closes the enclosing block.
+func (p *Parser) skipStatement(base int) {
+	for {
+		switch {
+		case p.curToken.Type == token.EOF:
+			return
+		case p.curToken.Type == token.SEMICOLON && p.depth == base:
+			return
+		case p.curToken.Type == token.RBRACE && p.depth < base:
+			return
+		}
+
+		if p.depth == base && (p.peekToken.Type == token.RBRACE || statementKeywords[p.peekToken.Type]) {
+			return
+		}
+		p.nextToken()
 	}
 }
 
+// braceDepth returns how a token changes the brace depth.
+func braceDepth(typ token.Type) int {
+	switch typ {
+	case token.LBRACE:
+		return 1
+	case token.RBRACE:
+		return -1
+	}
+	return 0
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	ls := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekToken.Type == token.LBRACKET || p.peekToken.Type == token.LBRACE {
+		p.nextToken()
+		if ls.Pattern = p.parseDestructuringPattern(); ls.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ls.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
 
-	ls.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekToken.Type == token.COLON {
+		p.nextToken()
+		p.nextToken()
+		ls.Type = p.parseType()
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -192,17 +420,140 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	ls.Value = p.parseExpression(LOWEST)
 
-	if fl, ok := ls.Value.(*ast.FunctionLiteral); ok {
+	if fl, ok := ls.Value.(*ast.FunctionLiteral); ok && ls.Name != nil {
 		fl.Name = ls.Name.Value
 	}
 
-	for p.curToken.Type != token.SEMICOLON {
+	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
 
 	return ls
 }
 
+// parseStructStatement parses `struct Name { field, fn method(r) { ... } }`.
+// Fields and methods are separated by commas, a trailing comma is allowed.
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	ss := &ast.StructStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	ss.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// the first field or method that isn't valid, reported once the body
+	// has been parsed
+	var invalid *Error
+	reject := func(kind ErrorKind, tok token.Token, format string, a ...interface{}) {
+		if invalid == nil {
+			invalid = &Error{Kind: kind, Message: fmt.Sprintf(format, a...), Found: tok, Line: tok.Line, Column: tok.Column}
+		}
+	}
+
+	seen := map[string]bool{}
+	for p.peekToken.Type != token.RBRACE {
+		p.nextToken()
+
+		var name *ast.Identifier
+		switch p.curToken.Type {
+		case token.IDENT:
+			name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			ss.Fields = append(ss.Fields, name)
+
+		case token.FUNCTION:
+			fnTok := p.curToken
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+			// the rest is a function literal, starting at the name
+			fl, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+			if !ok {
+				return nil
+			}
+			fl.Token = fnTok
+			if len(fl.Params) == 0 {
+				reject(MissingReceiver, name.Token, "method %s must take the record as its first parameter", name.Value)
+			}
+			ss.Methods = append(ss.Methods, &ast.Method{Name: name, Function: fl})
+
+		default:
+			p.errorAt(UnexpectedToken, p.curToken, "expected a field or method, got %s", p.curToken.Type)
+			return nil
+		}
+
+		if seen[name.Value] {
+			reject(DuplicateName, name.Token, "duplicate field or method %s in struct %s", name.Value, ss.Name.Value)
+		}
+		seen[name.Value] = true
+
+		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	ss.End = p.curToken
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	if invalid != nil {
+		// the statement ends here, there's nothing to resynchronize
+		p.errors = append(p.errors, *invalid)
+		return nil
+	}
+	return ss
+}
+
+// parseForStatement parses `for (v in iterable) { ... }` and
+// `for (k, v in iterable) { ... }`.
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	fs := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	fs.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		fs.Key, fs.Value = fs.Value, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if fs.Key.Value == fs.Value.Value {
+			p.errorAt(DuplicateName, fs.Value.Token, "duplicate loop variable %s", fs.Value.Value)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	fs.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	fs.Body = p.parseBlockStatement()
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return fs
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	rs := &ast.ReturnStatement{Token: p.curToken}
 
@@ -210,33 +561,61 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	rs.ReturnValue = p.parseExpression(LOWEST)
 
-	for p.curToken.Type != token.SEMICOLON && p.curToken.Type != token.EOF {
+	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
 
 	return rs
 }
 
+// parseYieldStatement parses `yield value;`, which makes the enclosing
+// function a generator.
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	ys := &ast.YieldStatement{Token: p.curToken}
+
+	if len(p.functions) == 0 || p.functions[len(p.functions)-1] == nil {
+		p.errorAt(MisplacedYield, p.curToken, "yield outside a function")
+		return nil
+	}
+	p.functions[len(p.functions)-1].Generator = true
+
+	p.nextToken()
+
+	ys.Value = p.parseExpression(LOWEST)
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return ys
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
+	depth := p.depth
 
 	p.nextToken()
 
 	for p.curToken.Type != token.RBRACE && p.curToken.Type != token.EOF {
-		if s := p.parseStatement(); s != nil {
+		s := p.parseStatement()
+		if s != nil {
 			block.Statements = append(block.Statements, s)
+		} else if p.curToken.Type == token.RBRACE && p.depth < depth {
+			// the broken statement ran into the end of the block
+			break
 		}
 		p.nextToken()
 	}
+	block.End = p.curToken
 
 	return block
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{
-		Token:      p.curToken,
-		Expression: p.parseExpression(LOWEST),
-	}
+	// the token has to be taken before parsing moves past it, the order of
+	// evaluation within a composite literal isn't guaranteed
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseExpression(LOWEST)
 
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
@@ -248,8 +627,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefixFn, ok := p.prefixParseFns[p.curToken.Type]
 	if !ok {
-		msg := fmt.Sprintf("no prefix parse function for %s found", p.curToken.Type)
-		p.errors = append(p.errors, msg)
+		p.errorAt(MissingExpression, p.curToken, "no prefix parse function for %s found", p.curToken.Type)
 		return nil
 	}
 
@@ -295,31 +673,83 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseFieldExpression(left ast.Expression) ast.Expression {
+	fe := &ast.FieldExpression{Token: p.curToken, Left: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	fe.Field = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return fe
+}
+
+// parseIndexExpression parses `left[index]` as well as the slices
+// `left[start:end]`, `left[start:]`, `left[:end]` and `left[:]`.
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
+
+	var index ast.Expression
+	if p.peekToken.Type != token.COLON {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if p.peekToken.Type != token.COLON {
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+	}
 
+	slice := &ast.SliceExpression{Token: tok, Left: left, Start: index}
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+
+	if p.peekToken.Type != token.RBRACKET {
+		p.nextToken()
+		slice.End = p.parseExpression(LOWEST)
+	}
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 
-	return exp
+	return slice
 }
 
+// parseCallExpression parses the arguments of a call, any of which may be
+// an array spread into separate arguments with `...`.
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	return &ast.CallExpression{
-		Token:     p.curToken,
-		Function:  function,
-		Arguments: p.parseExpList(token.RPAREN),
+	call := &ast.CallExpression{Token: p.curToken, Function: function, Arguments: []ast.Expression{}}
+
+	for p.peekToken.Type != token.RPAREN {
+		p.nextToken()
+		if p.curToken.Type == token.ELLIPSIS {
+			spread := &ast.SpreadExpression{Token: p.curToken}
+			p.nextToken()
+			spread.Value = p.parseExpression(LOWEST)
+			call.Arguments = append(call.Arguments, spread)
+		} else {
+			call.Arguments = append(call.Arguments, p.parseExpression(LOWEST))
+		}
+
+		if p.peekToken.Type != token.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		call.Arguments = nil
 	}
+	call.End = p.curToken
+	return call
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	return &ast.ArrayLiteral{
-		Token:    p.curToken,
-		Elements: p.parseExpList(token.RBRACKET),
-	}
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpList(token.RBRACKET)
+	array.End = p.curToken
+	return array
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
@@ -338,6 +768,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -346,28 +777,28 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.End = p.curToken
 
 	return hash
 }
 
+// parseExpList parses comma separated expressions up to end, a trailing
+// comma is allowed.
 func (p *Parser) parseExpList(end token.Type) []ast.Expression {
 	list := []ast.Expression{}
 
-	p.nextToken()
-
-	for p.curToken.Type != end {
-		element := p.parseExpression(LOWEST)
-		list = append(list, element)
-
+	for p.peekToken.Type != end {
 		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
 
-		if p.curToken.Type == token.COMMA {
-			p.nextToken()
+		if p.peekToken.Type != token.COMMA {
+			break
 		}
-		// TODO handle invalid syntax gracefully
-		// if !p.expectPeek(token.COMMA) {
-		// 	return nil
-		// }
+		p.nextToken()
+	}
+
+	if !p.expectPeek(end) {
+		return nil
 	}
 
 	return list
@@ -418,50 +849,357 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
-func (p *Parser) parseFunctionParameters() (params []*ast.Identifier) {
+// parseFunctionParameters parses a parenthesized list of parameters. The
+// parameters of functions, unlike those of macros, may be destructuring
+// patterns, may be followed by a colon and their type and may have a default
+// value. The last one may be variadic. These are recorded in fl, which is nil
+// for macros.
+func (p *Parser) parseFunctionParameters(fl *ast.FunctionLiteral) []*ast.Identifier {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
-	p.nextToken()
+	params := []*ast.Identifier{}
+	if fl != nil {
+		fl.ParamTypes, fl.ParamPatterns = []ast.TypeExpr{}, []ast.Pattern{}
+	}
+	for p.peekToken.Type != token.RPAREN {
+		if fl != nil && p.peekToken.Type == token.ELLIPSIS {
+			p.nextToken()
+			fl.Variadic = true
+		}
 
-	for p.curToken.Type != token.RPAREN {
-		param := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		params = append(params, param)
+		var pattern ast.Pattern
+		if fl != nil && !fl.Variadic && (p.peekToken.Type == token.LBRACKET || p.peekToken.Type == token.LBRACE) {
+			p.nextToken()
+			tok := p.curToken
+			if pattern = p.parseDestructuringPattern(); pattern == nil {
+				return nil
+			}
+			params = append(params, &ast.Identifier{Token: tok, Value: pattern.String()})
+		} else {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			params = append(params, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		}
+		if fl == nil {
+			if p.peekToken.Type != token.COMMA {
+				break
+			}
+			p.nextToken()
+			continue
+		}
+		fl.ParamPatterns = append(fl.ParamPatterns, pattern)
 
-		p.nextToken()
+		var typ ast.TypeExpr
+		if p.peekToken.Type == token.COLON {
+			p.nextToken()
+			p.nextToken()
+			typ = p.parseType()
+		}
+		fl.ParamTypes = append(fl.ParamTypes, typ)
 
-		// TODO: handle invalid syntax inside params
-		if p.curToken.Type == token.COMMA {
+		if !fl.Variadic && p.peekToken.Type == token.ASSIGN {
 			p.nextToken()
+			p.nextToken()
+			for len(fl.Defaults) < len(params)-1 {
+				fl.Defaults = append(fl.Defaults, nil)
+			}
+			fl.Defaults = append(fl.Defaults, p.parseExpression(LOWEST))
+		} else if len(fl.Defaults) > 0 && !fl.Variadic {
+			param := params[len(params)-1]
+			p.errorAt(MissingDefault, param.Token, "parameter %s without a default follows parameters with one", param.Value)
+			return nil
 		}
+
+		if fl.Variadic || p.peekToken.Type != token.COMMA {
+			// nothing may follow the variadic parameter
+			break
+		}
+		p.nextToken()
 	}
 
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
 	return params
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	fl := &ast.FunctionLiteral{Token: p.curToken}
 
-	fl.Params = p.parseFunctionParameters()
+	fl.Params = p.parseFunctionParameters(fl)
+
+	if p.peekToken.Type == token.ARROW {
+		p.nextToken()
+		p.nextToken()
+		fl.ReturnType = p.parseType()
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	p.functions = append(p.functions, fl)
 	fl.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
 	return fl
 }
 
+// parseType parses a type annotation: a name like int, [T] for arrays,
+// {K: V} for hashes or fn(T, U) -> R for functions.
+func (p *Parser) parseType() ast.TypeExpr {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+
+	case token.LBRACKET:
+		at := &ast.ArrayType{Token: p.curToken}
+		p.nextToken()
+		at.Element = p.parseType()
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return at
+
+	case token.LBRACE:
+		ht := &ast.HashType{Token: p.curToken}
+		p.nextToken()
+		ht.Key = p.parseType()
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		ht.Value = p.parseType()
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return ht
+
+	case token.FUNCTION:
+		ft := &ast.FunctionType{Token: p.curToken, Params: []ast.TypeExpr{}}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		for p.peekToken.Type != token.RPAREN {
+			p.nextToken()
+			ft.Params = append(ft.Params, p.parseType())
+			if p.peekToken.Type != token.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if p.peekToken.Type == token.ARROW {
+			p.nextToken()
+			p.nextToken()
+			ft.Return = p.parseType()
+		}
+		return ft
+
+	default:
+		p.errorAt(MissingType, p.curToken, "expected a type, got %s", p.curToken.Type)
+		return nil
+	}
+}
+
+// parseMatchExpression parses `match (value) { pattern => result, ... }`,
+// each pattern may be followed by `if guard`.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	me := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	me.Value = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for p.peekToken.Type != token.RBRACE {
+		p.nextToken()
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+
+		if p.peekToken.Type == token.IF {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.FAT_ARROW) {
+			return nil
+		}
+		p.nextToken()
+		arm.Body = p.parseExpression(LOWEST)
+		me.Arms = append(me.Arms, arm)
+
+		if p.peekToken.Type != token.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	me.End = p.curToken
+	return me
+}
+
+// parsePattern parses `_`, a name, a literal, `[p, ...rest]` or
+// `{"key": p}`.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		if p.curToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}
+		}
+		return &ast.BindingPattern{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+
+	case token.LBRACKET:
+		ap := &ast.ArrayPattern{Token: p.curToken, Elements: []ast.Pattern{}}
+		for p.peekToken.Type != token.RBRACKET {
+			p.nextToken()
+			if p.curToken.Type == token.ELLIPSIS {
+				if !p.expectPeek(token.IDENT) {
+					return nil
+				}
+				// the rest comes last
+				ap.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+				break
+			}
+			ap.Elements = append(ap.Elements, p.parsePattern())
+			if p.peekToken.Type != token.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return ap
+
+	case token.LBRACE:
+		hp := &ast.HashPattern{Token: p.curToken}
+		for p.peekToken.Type != token.RBRACE {
+			p.nextToken()
+			if p.curToken.Type == token.IDENT && p.peekToken.Type != token.COLON {
+				// {name} is short for {"name": name}
+				key := &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+				hp.Keys = append(hp.Keys, &ast.LiteralPattern{Token: p.curToken, Value: key})
+				hp.Values = append(hp.Values, p.parsePattern())
+			} else {
+				key := p.parseLiteralPattern()
+				if key == nil || !p.expectPeek(token.COLON) {
+					return nil
+				}
+				p.nextToken()
+				hp.Keys = append(hp.Keys, key)
+				hp.Values = append(hp.Values, p.parsePattern())
+			}
+			if p.peekToken.Type != token.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return hp
+	}
+
+	if lp := p.parseLiteralPattern(); lp != nil {
+		return lp
+	}
+	return nil
+}
+
+// parseDestructuringPattern parses the pattern of a let statement or a
+// parameter, which can't test values against literals.
+func (p *Parser) parseDestructuringPattern() ast.Pattern {
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
+	}
+	if lit := literalPattern(pattern); lit != nil {
+		p.errorAt(UnexpectedToken, lit.Token, "unexpected literal %s in destructuring pattern", lit)
+		return nil
+	}
+	return pattern
+}
+
+// literalPattern returns the first literal within a pattern, nil if there's
+// none. The keys of hash patterns don't count.
+func literalPattern(pattern ast.Pattern) *ast.LiteralPattern {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		return pattern
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			if lit := literalPattern(el); lit != nil {
+				return lit
+			}
+		}
+	case *ast.HashPattern:
+		for _, v := range pattern.Values {
+			if lit := literalPattern(v); lit != nil {
+				return lit
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseLiteralPattern() *ast.LiteralPattern {
+	lp := &ast.LiteralPattern{Token: p.curToken}
+
+	switch p.curToken.Type {
+	case token.INT, token.STRING, token.TRUE, token.FALSE:
+		lp.Value = p.prefixParseFns[p.curToken.Type]()
+	case token.MINUS:
+		if p.peekToken.Type != token.INT {
+			break
+		}
+		lp.Value = p.parsePrefixExpression()
+	}
+
+	if lp.Value == nil {
+		p.errorAt(MissingPattern, p.curToken, "expected a pattern, got %s", p.curToken.Type)
+		return nil
+	}
+	return lp
+}
+
+// parseImportExpression only accepts a plain string literal as the path, so
+// imports can be resolved at compile time.
+func (p *Parser) parseImportExpression() ast.Expression {
+	ie := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.STRING) {
+		return nil
+	}
+	ie.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return ie
+}
+
 func (p *Parser) parseMacroLiteral() ast.Expression {
 	ml := &ast.MacroLiteral{Token: p.curToken}
 
-	ml.Params = p.parseFunctionParameters()
+	ml.Params = p.parseFunctionParameters(nil)
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	p.functions = append(p.functions, nil)
 	ml.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
 	return ml
 }
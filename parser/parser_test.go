@@ -6,6 +6,7 @@ import (
 
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -131,6 +132,59 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringExpression(t *testing.T) {
+	input := `"total: ${a + b}, ${upper("x")}"`
+	program := parseInput(t, input)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	is, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+	if len(is.Parts) != 4 {
+		t.Fatalf("wrong number of parts. want=4, got=%d", len(is.Parts))
+	}
+
+	if lit, ok := is.Parts[0].(*ast.StringLiteral); !ok || lit.Value != "total: " {
+		t.Errorf("is.Parts[0] is not %q. got=%s", "total: ", is.Parts[0])
+	}
+	testInfixExpression(t, is.Parts[1], "a", "+", "b")
+	if lit, ok := is.Parts[2].(*ast.StringLiteral); !ok || lit.Value != ", " {
+		t.Errorf("is.Parts[2] is not %q. got=%s", ", ", is.Parts[2])
+	}
+	if _, ok := is.Parts[3].(*ast.CallExpression); !ok {
+		t.Errorf("is.Parts[3] is not *ast.CallExpression. got=%T", is.Parts[3])
+	}
+
+	expected := `"total: ${(a + b)}, ${upper(x)}"`
+	if is.String() != expected {
+		t.Errorf("is.String() wrong. want=%q, got=%q", expected, is.String())
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"${}"`, "no prefix parse function for EOF found"},
+		{`"${a b}"`, "unexpected IDENT in string interpolation"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	program := parseInput(t, input)
@@ -194,6 +248,395 @@ func TestParsingIndexExpressions(t *testing.T) {
 	testInfixExpression(t, indexExp.Index, 1, "+", 1)
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:2]", "(a[1:2])"},
+		{"a[1 + 1:]", "(a[(1 + 1):])"},
+		{"a[:-1]", "(a[:(-1)])"},
+		{"a[:]", "(a[:])"},
+		{"a[1:][0]", "((a[1:])[0])"},
+	}
+
+	program := parseInput(t, "a[1:]")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	slice, ok := stmt.Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+	}
+	testIdentifier(t, slice.Left, "a")
+	testIntegerLiteral(t, slice.Start, 1)
+	if slice.End != nil {
+		t.Errorf("slice.End is not nil. got=%s", slice.End)
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 1;", "let x: int = 1;"},
+		{"let xs: [string] = [];", "let xs: [string] = [];"},
+		{"let h: {string: [int]} = {};", "let h: {string: [int]} = {};"},
+		{"let f: fn(int, string) -> bool = g;", "let f: fn(int, string) -> bool = g;"},
+		{"let g: fn() = h;", "let g: fn() = h;"},
+		{"fn(a: string, b: [int]) -> bool { true }", "fn(a: string, b: [int]) -> booltrue"},
+		{"fn(a, b: int) { a }", "fn(a, b: int)a"},
+		{"fn(f: fn(int) -> int) -> fn() -> int { f }", "fn(f: fn(int) -> int) -> fn() -> intf"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := parseInput(t, "fn(a, b: int) -> bool { true }")
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if fn.ParamType(0) != nil {
+		t.Errorf("fn.ParamType(0) not nil. got=%s", fn.ParamType(0))
+	}
+	if typ, ok := fn.ParamType(1).(*ast.NamedType); !ok || typ.Name != "int" {
+		t.Errorf("fn.ParamType(1) not int. got=%v", fn.ParamType(1))
+	}
+	if typ, ok := fn.ReturnType.(*ast.NamedType); !ok || typ.Name != "bool" {
+		t.Errorf("fn.ReturnType not bool. got=%v", fn.ReturnType)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = arr;", "let [a, b, ...rest] = arr;"},
+		{"let {name, age} = person;", "let {name, age} = person;"},
+		{`let {"k": [x, _], name}: {string: any} = h`, `let {"k": [x, _], name}: {string: any} = h;`},
+		{"fn([a, b], {c}: {string: int}, d) { a }", "fn([a, b], {c}: {string: int}, d)a"},
+		{"match (x) { {name} => name }", "match (x) { {name} => name }"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := parseInput(t, "let f = fn([a], b) { a };")
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	if fn.Name != "f" || len(fn.Params) != 2 {
+		t.Fatalf("wrong function. got=%s", fn)
+	}
+	if _, ok := fn.ParamPattern(0).(*ast.ArrayPattern); !ok {
+		t.Errorf("fn.ParamPattern(0) not *ast.ArrayPattern. got=%T", fn.ParamPattern(0))
+	}
+	if fn.Params[0].Value != "[a]" || fn.ParamPattern(1) != nil {
+		t.Errorf("wrong parameters. got=%q, %v", fn.Params[0].Value, fn.ParamPattern(1))
+	}
+
+	program = parseInput(t, "let [x] = fn() { 1 };")
+	let = program.Statements[0].(*ast.LetStatement)
+	if let.Name != nil || let.Value.(*ast.FunctionLiteral).Name != "" {
+		t.Errorf("destructured function got a name. got=%s", let)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, 1] = b;", "unexpected literal 1 in destructuring pattern"},
+		{`fn({"k": "v"}) {}`, `unexpected literal "v" in destructuring pattern`},
+		{"let [a, b = c;", "expected next token to be ], got ="},
+		{"macro([a]) {}", "expected next token to be IDENT, got ["},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 10, ...rest) { a }", "fn(a, b = 10, ...rest)a"},
+		{"fn(a: int = 1 + 2, [b] = [1]) { a }", "fn(a: int = (1 + 2), [b] = [1])a"},
+		{"fn(...xs: [int]) { xs }", "fn(...xs: [int])xs"},
+		{"f(a, ...b, ...[1, 2])", "f(a, ...b, ...[1, 2])"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	fn := parseInput(t, "fn(a, b = 1, ...c) {}").Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if !fn.Variadic || fn.ParamDefault(0) != nil || fn.ParamDefault(1) == nil || fn.ParamDefault(2) != nil {
+		t.Errorf("wrong parameters. got=%s", fn)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) {}", "parameter b without a default follows parameters with one"},
+		{"fn(...a, b) {}", "expected next token to be ), got ,"},
+		{"fn(...a = 1) {}", "expected next token to be ), got ="},
+		{"fn(...[a]) {}", "expected next token to be IDENT, got ["},
+		{"macro(...a) {}", "expected next token to be IDENT, got ..."},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }", "struct Point { x, y }"},
+		{"struct Unit {}", "struct Unit {  }"},
+		{"struct P { x, fn norm(p) { p.x }, y, }", "struct P { x, y, fn norm(p)(p.x) }"},
+		{"a.b.c(1).d", "(((a.b).c)(1).d)"},
+		{"-p.x * q.f()[0]", "((-(p.x)) * ((q.f)()[0]))"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := parseInput(t, "struct Point { x, fn add(p, q: int) -> int { 1 } }")
+	ss, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.StructStatement. got=%T", program.Statements[0])
+	}
+	if ss.Name.Value != "Point" || len(ss.Fields) != 1 || len(ss.Methods) != 1 {
+		t.Fatalf("wrong struct. got=%s", ss)
+	}
+	if m := ss.Methods[0]; m.Name.Value != "add" || len(m.Function.Params) != 2 || m.Function.Name != "" || m.Function.ReturnType == nil {
+		t.Errorf("wrong method. got=%s", m)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"struct P { x, x }", "duplicate field or method x in struct P"},
+		{"struct P { x, fn x(p) {} }", "duplicate field or method x in struct P"},
+		{"struct P { fn m() {} }", "method m must take the record as its first parameter"},
+		{"struct P { 1 }", "expected a field or method, got INT"},
+		{"struct P { x y }", "expected next token to be ,, got IDENT"},
+		{"p.1", "expected next token to be IDENT, got INT"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x in xs) { puts(x); }", "for (x in xs) puts(x)"},
+		{"for (k, v in {1: 2}) { k + v }", "for (k, v in {1: 2}) (k + v)"},
+		{"for (i in range(0, 10)) {}", "for (i in range(0, 10)) "},
+		{"let f = fn() { for (c in s) { return c; } 0 };", "let f = fn(<f>)for (c in s) return c;0;"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := parseInput(t, "for (k, v in h) { v }")
+	fs, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if fs.Key == nil || fs.Key.Value != "k" || fs.Value.Value != "v" || len(fs.Body.Statements) != 1 {
+		t.Errorf("wrong for statement. got=%s", fs)
+	}
+	if !testIdentifier(t, fs.Iterable, "h") {
+		return
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"for x in xs {}", "expected next token to be (, got IDENT"},
+		{"for (x, x in xs) {}", "duplicate loop variable x"},
+		{"for (x of xs) {}", "expected next token to be IN, got IDENT"},
+		{"for ([a] in xs) {}", "expected next token to be IDENT, got ["},
+		{"for (x in xs) x", "expected next token to be {, got IDENT"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestYieldStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { yield 1; yield x + 1 }", "fn()yield 1;yield (x + 1);"},
+		{"fn() { for (x in xs) { yield x; } }", "fn()for (x in xs) yield x;"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := parseInput(t, "fn() { fn() { yield 1; }; 2 }")
+	outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	inner := outer.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if outer.Generator || !inner.Generator {
+		t.Errorf("wrong generator flags. outer=%t, inner=%t", outer.Generator, inner.Generator)
+	}
+
+	errors := []string{"yield 1;", "macro(x) { yield x; }", "if (true) { yield 1; }"}
+	for _, input := range errors {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != "yield outside a function" {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", input, "yield outside a function", errs)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { 1 => a, }", "match (x) { 1 => a }"},
+		{`match (x) { "a" => 1, -1 => 2, true => 3 }`, `match (x) { "a" => 1, -1 => 2, true => 3 }`},
+		{"match (f(x)) { _ => 0, n if n > 1 => n }", "match (f(x)) { _ => 0, n if (n > 1) => n }"},
+		{"match (x) { [] => 0, [a, _] => 1, [a, ...rest] => 2, [..._] => 3 }", "match (x) { [] => 0, [a, _] => 1, [a, ...rest] => 2, [..._] => 3 }"},
+		{`match (x) { {} => 0, {"k": [v], 1: {true: _}} => v }`, `match (x) { {} => 0, {"k": [v], 1: {true: _}} => v }`},
+		{"match (x) {}", "match (x) {  }"},
+		{"let y = match (x) { _ => 1 } + 1;", "let y = (match (x) { _ => 1 } + 1);"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := parseInput(t, "match (x) { [a, ...r] if a => {\"k\": v} }")
+	me := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	if len(me.Arms) != 1 {
+		t.Fatalf("wrong number of arms. want=1, got=%d", len(me.Arms))
+	}
+	pattern, ok := me.Arms[0].Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("pattern not *ast.ArrayPattern. got=%T", me.Arms[0].Pattern)
+	}
+	if len(pattern.Elements) != 1 || pattern.Rest == nil || pattern.Rest.Value != "r" {
+		t.Errorf("wrong array pattern. got=%s", pattern)
+	}
+	if _, ok := pattern.Elements[0].(*ast.BindingPattern); !ok {
+		t.Errorf("element not *ast.BindingPattern. got=%T", pattern.Elements[0])
+	}
+	if !testIdentifier(t, me.Arms[0].Guard, "a") {
+		return
+	}
+	if _, ok := me.Arms[0].Body.(*ast.HashLiteral); !ok {
+		t.Errorf("body not *ast.HashLiteral. got=%T", me.Arms[0].Body)
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { a + 1 => 2 }", "expected next token to be =>, got +"},
+		{"match (x) { (a) => 1 }", "expected a pattern, got ("},
+		{"match (x) { [...r, a] => 1 }", "expected next token to be ], got ,"},
+		{"match (x) { {k: 1} => 1 }", "expected a pattern, got IDENT"},
+		{"match (x) { -a => 1 }", "expected a pattern, got -"},
+		{"match x { _ => 1 }", "expected next token to be (, got IDENT"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestImportExpression(t *testing.T) {
+	program := parseInput(t, `let utils = import("lib/utils.mk");`)
+	stmt := program.Statements[0].(*ast.LetStatement)
+
+	imp, ok := stmt.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("stmt.Value not *ast.ImportExpression. got=%T", stmt.Value)
+	}
+	if imp.Path.Value != "lib/utils.mk" {
+		t.Errorf("imp.Path.Value not %q. got=%q", "lib/utils.mk", imp.Path.Value)
+	}
+	if imp.String() != `import("lib/utils.mk")` {
+		t.Errorf("imp.String() wrong. got=%q", imp.String())
+	}
+
+	p := New(lexer.New(`import(path)`))
+	p.ParseProgram()
+	expected := "expected next token to be STRING, got IDENT"
+	if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+		t.Errorf("wrong errors for non-literal path. want=%q, got=%q", expected, p.Errors())
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	input := "if (x > y) { x }"
 	program := parseInput(t, input)
@@ -739,6 +1182,197 @@ func TestMacroLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`let s = "abc`, `unterminated string literal "abc`},
+		{"let s = `abc", "unterminated string literal `abc"},
+		{`#`, `illegal character "#"`},
+		{"let a = 1; /* no end", "unterminated comment"},
+		{`let s = "a\qb";`, `invalid escape sequence \q`},
+		{`let s = "\u{D800}";`, `invalid escape sequence \u{D800}`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestCommentsAreSkipped(t *testing.T) {
+	input := `// leading
+let x = /* inline */ 1; // trailing
+/*
+ * block
+ */
+x // last`
+	program := parseInput(t, input)
+
+	if program.String() != "let x = 1;x" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	p := New(lexer.New("let a = 1;\n  let b 2;"))
+	p.ParseProgram()
+
+	errors := p.PositionedErrors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	expected := Error{
+		Kind:     UnexpectedToken,
+		Message:  "expected next token to be =, got INT",
+		Expected: token.ASSIGN,
+		Found:    token.Token{Type: token.INT, Literal: "2", Line: 2, Column: 9},
+		Line:     2,
+		Column:   9,
+	}
+	if errors[0] != expected {
+		t.Errorf("wrong error. want=%+v, got=%+v", expected, errors[0])
+	}
+}
+
+func TestInvalidEscapePosition(t *testing.T) {
+	p := New(lexer.New("let a = 1;\nlet s = \"ok\\n \\u{} \\q\";"))
+	p.ParseProgram()
+
+	errors := p.PositionedErrors()
+	if len(errors) != 1 {
+		t.Fatalf("expected one parser error, got %+v", errors)
+	}
+	expected := Error{
+		Kind:    InvalidEscape,
+		Message: `invalid escape sequence \u{}`,
+		Found:   token.Token{Type: token.ILLEGAL, Literal: `\u{}`, Line: 2, Column: 15},
+		Line:    2,
+		Column:  15,
+	}
+	if errors[0] != expected {
+		t.Errorf("wrong error. want=%+v, got=%+v", expected, errors[0])
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expectedKinds  []ErrorKind
+		expectedString string
+	}{
+		{
+			"let = 1; let x = 2;",
+			[]string{"expected next token to be IDENT, got ="},
+			[]ErrorKind{UnexpectedToken},
+			"let x = 2;",
+		},
+		{
+			"struct P { x, x, fn m() {} } P(1); let v = 2;",
+			[]string{"duplicate field or method x in struct P"},
+			[]ErrorKind{DuplicateName},
+			"P(1)let v = 2;",
+		},
+		{
+			"let f = fn() { struct Q { fn m() { 1 } } 2 };",
+			[]string{"method m must take the record as its first parameter"},
+			[]ErrorKind{MissingReceiver},
+			"let f = fn(<f>)2;",
+		},
+		{
+			"puts(1, 2; let y = (3 + ); y",
+			[]string{"expected next token to be ), got ;", "no prefix parse function for ) found"},
+			[]ErrorKind{UnexpectedToken, MissingExpression},
+			"y",
+		},
+		{
+			"if (x { 1 } let z = 3;",
+			[]string{"expected next token to be ), got {"},
+			[]ErrorKind{UnexpectedToken},
+			"let z = 3;",
+		},
+		{
+			"if (+) { let a = 1; }; let b = 2;",
+			[]string{"no prefix parse function for + found"},
+			[]ErrorKind{MissingExpression},
+			"let b = 2;",
+		},
+		{
+			"let c: = 1; let d: [int] = [];",
+			[]string{"expected a type, got ="},
+			[]ErrorKind{MissingType},
+			"let d: [int] = [];",
+		},
+		{
+			"fn() { let = 1; return 2; }; let w = 4;",
+			[]string{"expected next token to be IDENT, got ="},
+			[]ErrorKind{UnexpectedToken},
+			"fn()return 2;let w = 4;",
+		},
+		{
+			"let f = fn() { let x = } let v = 5; v",
+			[]string{"no prefix parse function for } found"},
+			[]ErrorKind{MissingExpression},
+			"let f = fn(<f>);let v = 5;v",
+		},
+		{
+			"} 1;\n2",
+			[]string{"no prefix parse function for } found"},
+			[]ErrorKind{MissingExpression},
+			"12",
+		},
+		{
+			"let f = fn(x) { if (x > 1 { x } else { 0 } }; f(1);",
+			[]string{"expected next token to be ), got {"},
+			[]ErrorKind{UnexpectedToken},
+			"let f = fn(<f>x);f(1)",
+		},
+		{
+			`{ "a": 1, "b" }; let e = 1;`,
+			[]string{"expected next token to be :, got }"},
+			[]ErrorKind{UnexpectedToken},
+			"let e = 1;",
+		},
+		{
+			"let a = 99999999999999999999; \"${1 +}\"; a",
+			[]string{"could not pase \"99999999999999999999\" as int64", "no prefix parse function for EOF found"},
+			[]ErrorKind{InvalidInteger, MissingExpression},
+			"a",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errors := p.PositionedErrors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. want=%q, got=%q", tt.input, tt.expectedErrors, p.Errors())
+			continue
+		}
+		for i, err := range errors {
+			if err.Message != tt.expectedErrors[i] || err.Kind != tt.expectedKinds[i] {
+				t.Errorf("wrong error %d for %q. want=%s %q, got=%s %q",
+					i, tt.input, tt.expectedKinds[i], tt.expectedErrors[i], err.Kind, err.Message)
+			}
+		}
+
+		if program.String() != tt.expectedString {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expectedString, program.String())
+		}
+	}
+}
+
 func parseInput(t *testing.T, input string) *ast.Program {
 	l := lexer.New(input)
 	p := New(l)
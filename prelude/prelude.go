@@ -0,0 +1,115 @@
+// Package prelude is the part of the standard library written in Monkey. It's
+// embedded into the binary and compiled once, programs start from a snapshot
+// of the result. The evaluator's programs start from an environment it was
+// evaluated into once.
+package prelude
+
+import (
+	_ "embed"
+	"fmt"
+	"sync"
+
+	"monkey/compiler"
+	"monkey/eval"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+)
+
+//go:embed prelude.mk
+var source string
+
+// Snapshot is the state of the compiler and the VM right after the prelude
+// ran. It must not be modified, programs build on copies of it.
+type Snapshot struct {
+	SymbolTable *compiler.SymbolTable
+	Constants   []object.Object
+	Globals     []object.Object
+}
+
+var (
+	once     sync.Once
+	snapshot *Snapshot
+)
+
+// Load returns the prelude snapshot, compiling and running the prelude the
+// first time it's called.
+func Load() *Snapshot {
+	once.Do(func() {
+		s, err := compile(source)
+		if err != nil {
+			panic(fmt.Sprintf("prelude: %s", err))
+		}
+		snapshot = s
+	})
+	return snapshot
+}
+
+func compile(src string) (*Snapshot, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", p.Errors()[0])
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	bytecode := comp.Bytecode()
+	globals := make([]object.Object, vm.GlobalsSize)
+	if err := vm.NewWithGlobalsStore(bytecode, globals).Run(); err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		SymbolTable: symbolTable,
+		Constants:   bytecode.Constants,
+		Globals:     globals[:symbolTable.NumDefinitions()],
+	}, nil
+}
+
+var (
+	envOnce sync.Once
+	env     *object.Environment
+)
+
+// Environment returns the values of the prelude for the evaluator, evaluating
+// the prelude the first time it's called. It must not be modified, programs
+// start out from it with object.NewEnvironmentFrom. The prelude's functions
+// keep referring to each other whatever names a program redefines.
+func Environment() *object.Environment {
+	envOnce.Do(func() {
+		p := parser.New(lexer.New(source))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			panic(fmt.Sprintf("prelude: %s", p.Errors()[0]))
+		}
+
+		env = object.NewEnvironment()
+		if result := eval.Eval(program, env); result != nil && result.Type() == object.ERROR_OBJ {
+			panic(fmt.Sprintf("prelude: %s", result.Inspect()))
+		}
+	})
+	return env
+}
+
+// Compiler returns a compiler for a program that can use the prelude.
+func (s *Snapshot) Compiler() *compiler.Compiler {
+	st := compiler.NewSymbolTableFrom(s.SymbolTable)
+	return compiler.NewWithState(st, s.Constants[:len(s.Constants):len(s.Constants)])
+}
+
+// NewGlobals returns a globals store for the VM holding the prelude's values.
+func (s *Snapshot) NewGlobals() []object.Object {
+	globals := make([]object.Object, vm.GlobalsSize)
+	copy(globals, s.Globals)
+	return globals
+}
@@ -0,0 +1,42 @@
+// The part of the standard library written in Monkey. Every program starts
+// with these defined, see package prelude.
+
+let identity = fn(x) { x };
+
+let compose = fn(f, g) { fn(x) { f(g(x)) } };
+
+let sum = fn(arr) { reduce(arr, fn(acc, x) { acc + x }, 0) };
+
+let product = fn(arr) { reduce(arr, fn(acc, x) { acc * x }, 1) };
+
+let max = fn(arr) {
+  if (len(arr) > 0) {
+    reduce(rest(arr), fn(m, x) { if (x > m) { x } else { m } }, first(arr))
+  }
+};
+
+let min = fn(arr) {
+  if (len(arr) > 0) {
+    reduce(rest(arr), fn(m, x) { if (x < m) { x } else { m } }, first(arr))
+  }
+};
+
+let find = fn(arr, pred) { first(filter(arr, pred)) };
+
+let count = fn(arr, pred) { len(filter(arr, pred)) };
+
+let includes = fn(arr, x) { any(arr, fn(y) { y == x }) };
+
+let group_by = fn(arr, key) {
+  reduce(arr, fn(groups, x) {
+    let k = key(x);
+    let group = if (has(groups, k)) { groups[k] } else { [] };
+    merge(groups, {k: push(group, x)})
+  }, {})
+};
+
+let take = fn(arr, n) { arr[:n] };
+
+let drop = fn(arr, n) { arr[n:] };
+
+let times = fn(n, f) { map(range(n), f) };
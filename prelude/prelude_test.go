@@ -0,0 +1,105 @@
+package prelude
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"monkey/eval"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+)
+
+func TestPrelude(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`identity(5)`, "5"},
+		{`compose(fn(x) { x + 1 }, fn(x) { x * 2 })(5)`, "11"},
+		{`[sum([1, 2, 3]), sum([])]`, "[6, 0]"},
+		{`product([2, 3, 4])`, "24"},
+		{`[max([3, 9, 2]), min([3, 9, 2]), max([])]`, "[9, 2, null]"},
+		{`[find([1, 5, 7], fn(x) { x > 4 }), find([1], fn(x) { x > 4 })]`, "[5, null]"},
+		{`count(["a", "bb", "cc"], fn(s) { len(s) == 2 })`, "2"},
+		{`[includes([1, [2]], [2]), includes([], 1)]`, "[true, false]"},
+		{`group_by(["apple", "kiwi", "avocado"], fn(s) { s[0] })`, "{a: [apple, avocado], k: [kiwi]}"},
+		{`[take([1, 2, 3], 2), drop([1, 2, 3], 2)]`, "[[1, 2], [3]]"},
+		{`times(3, fn(i) { i * i })`, "[0, 1, 4]"},
+		{`let sum = fn(x) { x }; sum([1])`, "[1]"},
+	}
+
+	for _, tt := range tests {
+		snapshot := Load()
+		comp := snapshot.Compiler()
+		if err := comp.Compile(parser.New(lexer.New(tt.input)).ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := vm.NewWithGlobalsStore(comp.Bytecode(), snapshot.NewGlobals())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if got := machine.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+
+		env := object.NewEnvironmentFrom(Environment(), nil)
+		if got := eval.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s in eval. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLoadCompilesOnce(t *testing.T) {
+	snapshot := Load()
+	if Load() != snapshot {
+		t.Fatalf("Load() compiled the prelude again")
+	}
+
+	// programs redefining a prelude name must not affect the snapshot
+	before := snapshot.SymbolTable.NumDefinitions()
+	comp := snapshot.Compiler()
+	if err := comp.Compile(parser.New(lexer.New(`let max = 1; let x = 2;`)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if after := snapshot.SymbolTable.NumDefinitions(); after != before {
+		t.Errorf("snapshot symbol table modified. want=%d definitions, got=%d", before, after)
+	}
+	if len(snapshot.Globals) != before {
+		t.Errorf("wrong number of globals. want=%d, got=%d", before, len(snapshot.Globals))
+	}
+}
+
+func TestModulesSeePrelude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(`let total = sum([1, 2]);`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := Load()
+	comp := snapshot.Compiler()
+	comp.SetFile(filepath.Join(dir, "main.mk"))
+	input := `let sum = 0; import("lib.mk")["total"] + sum`
+	if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.NewWithGlobalsStore(comp.Bytecode(), snapshot.NewGlobals())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if got := machine.LastPoppedStackElem().Inspect(); got != "3" {
+		t.Errorf("wrong result. want=%q, got=%q", "3", got)
+	}
+
+	env := object.NewEnvironmentFrom(Environment(), nil)
+	eval.SetFile(env, filepath.Join(dir, "main.mk"))
+	if got := eval.Eval(parser.New(lexer.New(input)).ParseProgram(), env).Inspect(); got != "3" {
+		t.Errorf("wrong result in eval. want=%q, got=%q", "3", got)
+	}
+}
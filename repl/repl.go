@@ -1,38 +1,45 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"os"
 
 	"monkey/compiler"
 	"monkey/eval"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/prelude"
 	"monkey/vm"
 )
 
 const PROMPT = ">>> "
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWithHost(object.NewHost(in, out, os.Stderr))
+}
 
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
+// StartWithHost runs the REPL on host's streams. Programs entered share them,
+// so read_line consumes the lines following the one that called it.
+func StartWithHost(host *object.Host) {
+	out := host.Stdout
 
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	snapshot := prelude.Load()
+	constants := snapshot.Constants
+	globals := snapshot.NewGlobals()
+	symbolTable := compiler.NewSymbolTableFrom(snapshot.SymbolTable)
+	// imported modules are compiled and run once per session
+	modules := compiler.NewModules()
+	namespaces := map[int]object.Object{}
 
 	for {
 		fmt.Fprintf(out, PROMPT)
-		if !scanner.Scan() {
+		line, ok, err := host.ReadLine()
+		if !ok || err != nil {
 			return
 		}
 
-		line := scanner.Text()
 		l := lexer.New(line)
 		p := parser.New(l)
 		program := p.ParseProgram()
@@ -46,17 +53,27 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
+		// compile against copies of the session state, so that a line that
+		// fails halfway through doesn't leave half-defined symbols or
+		// orphaned constants behind
+		st := symbolTable.Copy()
+		mods := modules.Copy()
+		comp := compiler.NewWithState(st, constants[:len(constants):len(constants)])
+		comp.SetModules(mods)
+		err = comp.Compile(program)
 		if err != nil {
 			fmt.Fprintf(out, "Compilation failed:\n %s\n", err)
 			continue
 		}
 
 		code := comp.Bytecode()
+		symbolTable = st
+		modules = mods
 		constants = code.Constants
 
 		machine := vm.NewWithGlobalsStore(code, globals)
+		machine.SetHost(host)
+		machine.SetModules(namespaces)
 		err = machine.Run()
 		if err != nil {
 			fmt.Fprintf(out, "Executing bytecode failed:\n %s\n", err)
@@ -76,18 +93,17 @@ func Start(in io.Reader, out io.Writer) {
 }
 
 func StartInterpreter(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	host := object.NewHost(in, out, os.Stderr)
+	env := object.NewEnvironmentFrom(prelude.Environment(), host)
 	macroEnv := object.NewEnvironment()
 
 	for {
 		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, ok, err := host.ReadLine()
+		if !ok || err != nil {
 			return
 		}
 
-		line := scanner.Text()
 		l := lexer.New(line)
 		p := parser.New(l)
 
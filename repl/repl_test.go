@@ -0,0 +1,109 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartRecoversFromFailedCompilation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			// `b` must not stay defined after the line failed to compile
+			"let a = 1;\nlet b = c;\nb\na\n",
+			[]string{
+				"Compilation failed:\n undefined variable c",
+				"Compilation failed:\n undefined variable b",
+				"1",
+			},
+		},
+		{
+			"let f = fn() { x };\nlet x = 5; x\n",
+			[]string{
+				"Compilation failed:\n undefined variable x",
+				"5",
+			},
+		},
+		{
+			"let a = 1 + true;\na\n",
+			[]string{
+				"Executing bytecode failed:\n unsupported types for binary operation: INTEGER BOOLEAN",
+				"Executing bytecode failed:\n variable a used before being set",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		got := out.String()
+		for _, want := range tt.expected {
+			idx := strings.Index(got, want)
+			if idx < 0 {
+				t.Fatalf("output for %q does not contain %q. got=%q", tt.input, want, out.String())
+			}
+			got = got[idx+len(want):]
+		}
+	}
+}
+
+func TestStartSharesInputWithReadLine(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let name = read_line();\nMonkey\nname\n"), &out)
+
+	expected := ">>> Monkey\n>>> Monkey\n>>> "
+	if out.String() != expected {
+		t.Fatalf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestBothEnginesHavePrelude(t *testing.T) {
+	input := "let sum = 1; max([3, 9]) + sum\nuniq([1, 1, 2])\n"
+	expected := ">>> 10\n>>> [1, 2]\n>>> "
+
+	for name, start := range map[string]func(io.Reader, io.Writer){"compiler": Start, "interpreter": StartInterpreter} {
+		var out bytes.Buffer
+		start(strings.NewReader(input), &out)
+		if out.String() != expected {
+			t.Errorf("wrong output of the %s. want=%q, got=%q", name, expected, out.String())
+		}
+	}
+}
+
+func TestBothEnginesPrintLoops(t *testing.T) {
+	input := "for (x in [1, 2]) { x }\nlet g = fn() { yield 1; }; for (x in g()) { x }\n"
+	expected := ">>> null\n>>> null\n>>> "
+
+	for name, start := range map[string]func(io.Reader, io.Writer){"compiler": Start, "interpreter": StartInterpreter} {
+		var out bytes.Buffer
+		start(strings.NewReader(input), &out)
+		if out.String() != expected {
+			t.Errorf("wrong output of the %s. want=%q, got=%q", name, expected, out.String())
+		}
+	}
+}
+
+func TestBothEnginesImportModulesOncePerSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(path, []byte(`puts("loading"); let x = 1;`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "let u = import(\"" + path + "\");\nlet v = import(\"" + path + "\");\nu == v\n"
+
+	for name, start := range map[string]func(io.Reader, io.Writer){"compiler": Start, "interpreter": StartInterpreter} {
+		var out bytes.Buffer
+		start(strings.NewReader(input), &out)
+		got := out.String()
+		if strings.Count(got, "loading") != 1 || !strings.HasSuffix(got, ">>> true\n>>> ") {
+			t.Errorf("the %s ran the module more than once or made two namespaces. got=%q", name, got)
+		}
+	}
+}
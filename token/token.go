@@ -1,10 +1,14 @@
 package token
 
+import "sort"
+
 type Type string
 
 type Token struct {
 	Type    Type
 	Literal string
+	Line    int // 1-based line of the first character
+	Column  int // 1-based column of the first character, counted in characters
 }
 
 const (
@@ -17,6 +21,15 @@ const (
 	INT    = "INT"
 	STRING = "STRING"
 
+	// String with `${...}` interpolations, the literal is the raw source
+	// between the quotes
+	TEMPLATE = "TEMPLATE"
+
+	// `// ...` up to the end of the line or `/* ... */`. The parser skips
+	// comments, they're only kept for tools working on the source, like the
+	// formatter.
+	COMMENT = "COMMENT"
+
 	// Operators
 
 	ASSIGN   = "="
@@ -31,6 +44,15 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	// ARROW precedes the result type of a function type annotation
+	ARROW = "->"
+	// FAT_ARROW separates the pattern of a match arm from its result
+	FAT_ARROW = "=>"
+	// ELLIPSIS precedes the name taking the rest of an array pattern
+	ELLIPSIS = "..."
+	// DOT accesses a field or method of a record
+	DOT = "."
+
 	// Delimiters
 
 	COMMA     = ","
@@ -53,6 +75,12 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	MACRO    = "MACRO"
+	IMPORT   = "IMPORT"
+	MATCH    = "MATCH"
+	STRUCT   = "STRUCT"
+	FOR      = "FOR"
+	IN       = "IN"
+	YIELD    = "YIELD"
 )
 
 var keywords = map[string]Type{
@@ -64,6 +92,22 @@ var keywords = map[string]Type{
 	"else":   ELSE,
 	"return": RETURN,
 	"macro":  MACRO,
+	"import": IMPORT,
+	"match":  MATCH,
+	"struct": STRUCT,
+	"for":    FOR,
+	"in":     IN,
+	"yield":  YIELD,
+}
+
+// Keywords returns the reserved words of the language, sorted.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 func LookupIdent(ident string) Type {
@@ -0,0 +1,975 @@
+// Package typecheck infers the types of Monkey programs and reports
+// operations on values of the wrong type before they run. Type annotations
+// are optional: what can't be inferred is of type any, which is compatible
+// with every type, so unannotated code is checked only as far as literals
+// and builtins reveal its types.
+package typecheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"monkey/ast"
+	"monkey/token"
+)
+
+// Diagnostic is a type error found at a position in the source.
+type Diagnostic struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Check infers the types of the program and reports mismatches, ordered by
+// position. The program must have parsed without errors.
+func Check(program *ast.Program) []Diagnostic {
+	c := &checker{scope: &scope{vars: map[string]typ{}}, records: map[string]*recordType{}}
+	c.statements(program.Statements)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+// typ is the type of a value. Types are compared by their names.
+type typ interface {
+	String() string
+}
+
+type basicType string
+
+func (t basicType) String() string { return string(t) }
+
+var (
+	intType    typ = basicType("int")
+	stringType typ = basicType("string")
+	boolType   typ = basicType("bool")
+	nullType   typ = basicType("null")
+	anyType    typ = basicType("any")
+)
+
+var basicTypes = map[string]typ{
+	"int":    intType,
+	"string": stringType,
+	"bool":   boolType,
+	"null":   nullType,
+	"any":    anyType,
+}
+
+type arrayType struct {
+	elem typ
+}
+
+func (t *arrayType) String() string { return "[" + t.elem.String() + "]" }
+
+type hashType struct {
+	key, value typ
+}
+
+func (t *hashType) String() string { return "{" + t.key.String() + ": " + t.value.String() + "}" }
+
+// recordType is the type of the records of a struct, members has the names
+// of its fields and methods.
+type recordType struct {
+	name    string
+	members map[string]bool
+}
+
+func (t *recordType) String() string { return t.name }
+
+// funcType is the type of functions, params is nil if they aren't known.
+// The last optional ones of the params may be left out, the last of all
+// takes the extra arguments if variadic.
+type funcType struct {
+	params   []typ
+	result   typ
+	optional int
+	variadic bool
+}
+
+func (t *funcType) String() string {
+	if t.params == nil {
+		return "fn(...) -> " + t.result.String()
+	}
+	params := make([]string, len(t.params))
+	for i, p := range t.params {
+		params[i] = p.String()
+		switch {
+		case t.variadic && i == len(t.params)-1:
+			params[i] = "..." + params[i]
+		case i >= len(t.params)-t.optional:
+			params[i] += "?"
+		}
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + t.result.String()
+}
+
+// generatorType is the type of the generators returned by calling
+// functions that yield values of type elem.
+type generatorType struct {
+	elem typ
+}
+
+func (t *generatorType) String() string { return "generator(" + t.elem.String() + ")" }
+
+// param returns the type of the i-th argument of a call, or nil if it isn't
+// known.
+func (t *funcType) param(i int) typ {
+	switch {
+	case t.variadic && i >= len(t.params)-1:
+		if rest, ok := t.params[len(t.params)-1].(*arrayType); ok {
+			return rest.elem
+		}
+	case i < len(t.params):
+		return t.params[i]
+	}
+	return nil
+}
+
+// flexible reports whether the function may be called with different
+// numbers of arguments.
+func (t *funcType) flexible() bool {
+	return t.optional > 0 || t.variadic
+}
+
+// builtinResults are the types of the results of the builtins that always
+// return the same type when they don't fail. The arguments of builtins
+// aren't checked.
+var builtinResults = map[string]typ{
+	"puts":           nullType,
+	"print":          nullType,
+	"eprint":         nullType,
+	"len":            intType,
+	"index_of":       intType,
+	"split":          &arrayType{stringType},
+	"chars":          &arrayType{stringType},
+	"bytes":          &arrayType{intType},
+	"range":          &arrayType{intType},
+	"join":           stringType,
+	"trim":           stringType,
+	"upper":          stringType,
+	"lower":          stringType,
+	"replace":        stringType,
+	"substr":         stringType,
+	"repeat":         stringType,
+	"format":         stringType,
+	"json_stringify": stringType,
+	"type":           stringType,
+	"contains":       boolType,
+	"starts_with":    boolType,
+	"ends_with":      boolType,
+	"has":            boolType,
+	"any":            boolType,
+	"all":            boolType,
+}
+
+// compatible reports whether values of type a may be used where b is
+// expected. any is compatible with every type both ways.
+func compatible(a, b typ) bool {
+	if a == anyType || b == anyType {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *arrayType:
+		b, ok := b.(*arrayType)
+		return ok && compatible(a.elem, b.elem)
+	case *hashType:
+		b, ok := b.(*hashType)
+		return ok && compatible(a.key, b.key) && compatible(a.value, b.value)
+	case *generatorType:
+		b, ok := b.(*generatorType)
+		return ok && compatible(a.elem, b.elem)
+	case *funcType:
+		b, ok := b.(*funcType)
+		if !ok || !compatible(a.result, b.result) {
+			return false
+		}
+		if a.params == nil || b.params == nil {
+			return true
+		}
+		if len(a.params) != len(b.params) && !a.flexible() && !b.flexible() {
+			return false
+		}
+		for i := range a.params {
+			if i < len(b.params) && !compatible(a.params[i], b.params[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// join is the type of a value that's either of type a or b.
+func join(a, b typ) typ {
+	if a.String() == b.String() {
+		return a
+	}
+	if a, ok := a.(*arrayType); ok {
+		if b, ok := b.(*arrayType); ok {
+			return &arrayType{join(a.elem, b.elem)}
+		}
+	}
+	return anyType
+}
+
+type scope struct {
+	vars  map[string]typ
+	outer *scope
+}
+
+func (s *scope) lookup(name string) (typ, bool) {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.vars[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// function is the function being checked.
+type function struct {
+	declared typ // the annotated result type, nil if there's none
+	returns  typ // the join of the types returned so far, nil if none
+	yields   typ // the join of the types yielded so far, nil if none
+}
+
+type checker struct {
+	scope       *scope
+	fn          *function
+	records     map[string]*recordType // by name, for annotations
+	diagnostics []Diagnostic
+
+	// within interpolations positions are relative to the embedded
+	// expression, so they're reported at the string instead
+	template *token.Token
+}
+
+func (c *checker) report(tok token.Token, format string, a ...interface{}) {
+	if c.template != nil {
+		tok = *c.template
+	}
+	c.diagnostics = append(c.diagnostics, Diagnostic{Message: fmt.Sprintf(format, a...), Line: tok.Line, Column: tok.Column})
+}
+
+// statements checks a sequence of statements and returns the type of the
+// value it evaluates to.
+func (c *checker) statements(stmts []ast.Statement) typ {
+	result := nullType
+	for _, s := range stmts {
+		result = c.statement(s)
+	}
+	return result
+}
+
+func (c *checker) statement(s ast.Statement) typ {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		var declared typ
+		if s.Type != nil {
+			declared = c.resolve(s.Type)
+		}
+
+		if s.Pattern != nil {
+			t := c.typed(s.Value, declared)
+			if declared != nil {
+				if !compatible(t, declared) {
+					c.report(start(s.Value), "cannot assign %s to %s of type %s", t, s.Pattern, declared)
+				}
+				t = declared
+			}
+			c.destructure(s.Pattern, t)
+			return nullType
+		}
+
+		// defined first, so recursive functions know their own type
+		if fn, ok := s.Value.(*ast.FunctionLiteral); ok && declared == nil {
+			c.scope.vars[s.Name.Value] = c.signature(fn)
+		} else if declared != nil {
+			c.scope.vars[s.Name.Value] = declared
+		}
+
+		t := c.typed(s.Value, declared)
+		if declared != nil && !compatible(t, declared) {
+			c.report(start(s.Value), "cannot assign %s to %s of type %s", t, s.Name.Value, declared)
+		}
+		if declared == nil {
+			c.scope.vars[s.Name.Value] = t
+		}
+		return nullType
+
+	case *ast.StructStatement:
+		rt := &recordType{name: s.Name.Value, members: map[string]bool{}}
+		constructor := &funcType{params: make([]typ, len(s.Fields)), result: rt}
+		for i, f := range s.Fields {
+			rt.members[f.Value] = true
+			constructor.params[i] = anyType
+		}
+		for _, m := range s.Methods {
+			rt.members[m.Name.Value] = true
+		}
+		c.records[rt.name] = rt
+		c.scope.vars[rt.name] = constructor
+
+		for _, m := range s.Methods {
+			c.functionLiteral(m.Function)
+		}
+		return nullType
+
+	case *ast.ForStatement:
+		key, value := c.elements(s.Iterable, s.Key == nil)
+		c.block(func() {
+			if s.Key != nil {
+				c.scope.vars[s.Key.Value] = key
+			}
+			c.scope.vars[s.Value.Value] = value
+			c.statements(s.Body.Statements)
+		})
+		return nullType
+
+	case *ast.ReturnStatement:
+		var declared typ
+		if c.fn != nil {
+			declared = c.fn.declared
+		}
+		t := c.typed(s.ReturnValue, declared)
+		c.returned(s.ReturnValue, t)
+		return anyType
+
+	case *ast.YieldStatement:
+		t := c.expression(s.Value)
+		if c.fn.yields == nil {
+			c.fn.yields = t
+		} else {
+			c.fn.yields = join(c.fn.yields, t)
+		}
+		return nullType
+
+	case *ast.ExpressionStatement:
+		return c.expression(s.Expression)
+	}
+	return anyType
+}
+
+// returned records a value returned from the current function.
+func (c *checker) returned(value ast.Expression, t typ) {
+	fn := c.fn
+	if fn == nil {
+		return
+	}
+	if fn.declared != nil && !compatible(t, fn.declared) {
+		c.report(start(value), "cannot return %s from a function returning %s", t, fn.declared)
+	}
+	if fn.returns == nil {
+		fn.returns = t
+	} else {
+		fn.returns = join(fn.returns, t)
+	}
+}
+
+// typed returns the type of e, which is expected to be of type want unless
+// that's nil. Array and hash literals are checked against want element by
+// element: the type of a literal with mixed elements is too vague to tell if
+// they match, so the elements that don't are reported here. Such a literal
+// is of type want then.
+func (c *checker) typed(e ast.Expression, want typ) typ {
+	switch lit := e.(type) {
+	case *ast.ArrayLiteral:
+		want, ok := want.(*arrayType)
+		if !ok || len(lit.Elements) == 0 {
+			break
+		}
+		types := make([]typ, len(lit.Elements))
+		elem := c.typed(lit.Elements[0], want.elem)
+		for i, el := range lit.Elements {
+			if i == 0 {
+				types[i] = elem
+				continue
+			}
+			types[i] = c.typed(el, want.elem)
+			elem = join(elem, types[i])
+		}
+		if !compatible(elem, want.elem) {
+			return &arrayType{elem}
+		}
+		for i, t := range types {
+			if !compatible(t, want.elem) {
+				c.report(start(lit.Elements[i]), "cannot use %s as %s in element %d of %s", t, want.elem, i+1, want)
+			}
+		}
+		return want
+
+	case *ast.HashLiteral:
+		want, ok := want.(*hashType)
+		if !ok || len(lit.Keys) == 0 {
+			break
+		}
+		var key, value typ
+		keys, values := make([]typ, len(lit.Keys)), make([]typ, len(lit.Keys))
+		for i, k := range lit.Keys {
+			keys[i], values[i] = c.typed(k, want.key), c.typed(lit.Pairs[k], want.value)
+			if !hashable(keys[i]) {
+				c.report(start(k), "unusable as hash key: %s", keys[i])
+			}
+			if i == 0 {
+				key, value = keys[i], values[i]
+			} else {
+				key, value = join(key, keys[i]), join(value, values[i])
+			}
+		}
+		if !compatible(key, want.key) || !compatible(value, want.value) {
+			return &hashType{key, value}
+		}
+		for i, k := range lit.Keys {
+			if !compatible(keys[i], want.key) {
+				c.report(start(k), "cannot use %s as %s in key of %s", keys[i], want.key, want)
+			}
+			if !compatible(values[i], want.value) {
+				c.report(start(lit.Pairs[k]), "cannot use %s as %s in value of %s", values[i], want.value, want)
+			}
+		}
+		return want
+	}
+	return c.expression(e)
+}
+
+func (c *checker) expression(e ast.Expression) typ {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return intType
+
+	case *ast.StringLiteral:
+		return stringType
+
+	case *ast.Boolean:
+		return boolType
+
+	case *ast.InterpolatedString:
+		if c.template == nil {
+			c.template = &e.Token
+			defer func() { c.template = nil }()
+		}
+		for _, p := range e.Parts {
+			c.expression(p)
+		}
+		return stringType
+
+	case *ast.Identifier:
+		if t, ok := c.scope.lookup(e.Value); ok {
+			return t
+		}
+		if result, ok := builtinResults[e.Value]; ok {
+			return &funcType{result: result}
+		}
+		return anyType
+
+	case *ast.PrefixExpression:
+		t := c.expression(e.Right)
+		if e.Operator == "!" {
+			return boolType
+		}
+		if !compatible(t, intType) {
+			c.report(e.Token, "unknown operator: %s%s", e.Operator, t)
+		}
+		return intType
+
+	case *ast.InfixExpression:
+		return c.infix(e)
+
+	case *ast.IfExpression:
+		c.expression(e.Condition)
+		consequence := c.statements(e.Consequence.Statements)
+		if e.Alternative == nil {
+			return anyType
+		}
+		return join(consequence, c.statements(e.Alternative.Statements))
+
+	case *ast.MatchExpression:
+		return c.match(e)
+
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(e)
+
+	case *ast.CallExpression:
+		return c.call(e)
+
+	case *ast.ArrayLiteral:
+		var elem typ
+		for _, el := range e.Elements {
+			t := c.expression(el)
+			if elem == nil {
+				elem = t
+			} else {
+				elem = join(elem, t)
+			}
+		}
+		if elem == nil {
+			elem = anyType
+		}
+		return &arrayType{elem}
+
+	case *ast.HashLiteral:
+		var key, value typ
+		for _, k := range e.Keys {
+			kt, vt := c.expression(k), c.expression(e.Pairs[k])
+			if !hashable(kt) {
+				c.report(start(k), "unusable as hash key: %s", kt)
+			}
+			if key == nil {
+				key, value = kt, vt
+			} else {
+				key, value = join(key, kt), join(value, vt)
+			}
+		}
+		if key == nil {
+			key, value = anyType, anyType
+		}
+		return &hashType{key, value}
+
+	case *ast.IndexExpression:
+		return c.index(e)
+
+	case *ast.FieldExpression:
+		switch left := c.expression(e.Left).(type) {
+		case *recordType:
+			if !left.members[e.Field.Value] {
+				c.report(e.Field.Token, "%s has no field or method %s", left, e.Field.Value)
+			}
+		case *generatorType:
+			if e.Field.Value == "next" {
+				// null once the generator is done
+				return &funcType{params: []typ{}, result: join(left.elem, nullType)}
+			}
+			c.report(e.Field.Token, "%s has no field or method %s", left, e.Field.Value)
+		default:
+			if left != anyType {
+				c.report(e.Token, "field access not supported: %s", left)
+			}
+		}
+		return anyType
+
+	case *ast.SliceExpression:
+		left := c.expression(e.Left)
+		for _, bound := range []ast.Expression{e.Start, e.End} {
+			if bound == nil {
+				continue
+			}
+			if t := c.expression(bound); !compatible(t, intType) {
+				c.report(start(bound), "slice bounds must be int, got %s", t)
+			}
+		}
+		switch left.(type) {
+		case *arrayType:
+			return left
+		case basicType:
+			if left == stringType || left == anyType {
+				return left
+			}
+		}
+		c.report(e.Token, "slice operator not supported: %s", left)
+		return anyType
+	}
+
+	// imports and macros
+	return anyType
+}
+
+// elements returns the types of the keys and values a for loop over the
+// iterable binds. A loop with a single variable binds the keys of hashes.
+func (c *checker) elements(iterable ast.Expression, single bool) (typ, typ) {
+	switch t := c.expression(iterable).(type) {
+	case *arrayType:
+		return intType, t.elem
+	case *hashType:
+		if single {
+			return t.key, t.key
+		}
+		return t.key, t.value
+	case *generatorType:
+		return intType, t.elem
+	default:
+		if t == stringType {
+			return intType, stringType
+		}
+		if t != anyType {
+			c.report(start(iterable), "cannot iterate over %s", t)
+		}
+		return anyType, anyType
+	}
+}
+
+// match checks the arms of a match expression, the names in patterns are
+// typed after the parts of the value they're bound to.
+// block checks in a scope of its own, for the names only a part of a
+// function can see, like the compiler's blocks.
+func (c *checker) block(check func()) {
+	outer := c.scope
+	c.scope = &scope{vars: map[string]typ{}, outer: outer}
+	defer func() { c.scope = outer }()
+	check()
+}
+
+func (c *checker) match(e *ast.MatchExpression) typ {
+	value := c.expression(e.Value)
+
+	var result typ
+	exhaustive := false
+	for _, arm := range e.Arms {
+		var t typ
+		c.block(func() {
+			c.pattern(arm.Pattern, value)
+			if arm.Guard != nil {
+				c.expression(arm.Guard)
+			}
+			t = c.expression(arm.Body)
+		})
+		if result == nil {
+			result = t
+		} else {
+			result = join(result, t)
+		}
+
+		switch arm.Pattern.(type) {
+		case *ast.WildcardPattern, *ast.BindingPattern:
+			exhaustive = exhaustive || arm.Guard == nil
+		}
+	}
+
+	if result == nil {
+		return nullType
+	}
+	if !exhaustive {
+		// null if no arm matches
+		return join(result, nullType)
+	}
+	return result
+}
+
+// destructure types the names of a let or parameter pattern, reporting
+// values that are known not to be arrays or hashes as the pattern says.
+func (c *checker) destructure(pattern ast.Pattern, t typ) {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		if g, ok := t.(*generatorType); ok {
+			// taken apart as an array of the values it yields
+			t = &arrayType{g.elem}
+		}
+		if _, ok := t.(*arrayType); !ok && t != anyType {
+			c.report(pattern.Token, "cannot destructure %s as an array", t)
+		}
+	case *ast.HashPattern:
+		if _, ok := t.(*hashType); !ok && t != anyType {
+			c.report(pattern.Token, "cannot destructure %s as a hash", t)
+		}
+	}
+	c.pattern(pattern, t)
+}
+
+func (c *checker) pattern(pattern ast.Pattern, t typ) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		c.scope.vars[pattern.Name.Value] = t
+
+	case *ast.ArrayPattern:
+		elem := anyType
+		if t, ok := t.(*arrayType); ok {
+			elem = t.elem
+		}
+		for _, el := range pattern.Elements {
+			c.pattern(el, elem)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			c.scope.vars[pattern.Rest.Value] = &arrayType{elem}
+		}
+
+	case *ast.HashPattern:
+		value := anyType
+		if t, ok := t.(*hashType); ok {
+			value = t.value
+		}
+		for _, v := range pattern.Values {
+			c.pattern(v, value)
+		}
+	}
+}
+
+func (c *checker) infix(e *ast.InfixExpression) typ {
+	left, right := c.expression(e.Left), c.expression(e.Right)
+
+	var result typ
+	var operands []typ // the types the operator supports
+	switch e.Operator {
+	case "==", "!=":
+		if !compatible(left, right) {
+			c.report(e.Token, "type mismatch: %s %s %s", left, e.Operator, right)
+		}
+		return boolType
+	case "<", ">":
+		result, operands = boolType, []typ{intType}
+	case "+":
+		result, operands = anyType, []typ{intType, stringType}
+		if left != anyType {
+			result = left
+		} else if right != anyType {
+			result = right
+		}
+	default:
+		result, operands = intType, []typ{intType}
+	}
+
+	if !compatible(left, right) {
+		c.report(e.Token, "type mismatch: %s %s %s", left, e.Operator, right)
+		return result
+	}
+	for _, t := range operands {
+		if compatible(left, t) && compatible(right, t) {
+			return result
+		}
+	}
+	c.report(e.Token, "unknown operator: %s %s %s", left, e.Operator, right)
+	return result
+}
+
+// signature returns the type of fn as far as its annotations tell.
+func (c *checker) signature(fn *ast.FunctionLiteral) *funcType {
+	t := &funcType{params: make([]typ, len(fn.Params)), result: anyType, variadic: fn.Variadic}
+	for i := range fn.Params {
+		t.params[i] = anyType
+		if annotation := fn.ParamType(i); annotation != nil {
+			t.params[i] = c.resolve(annotation)
+		} else if fn.Variadic && i == len(fn.Params)-1 {
+			t.params[i] = &arrayType{anyType}
+		}
+		if fn.ParamDefault(i) != nil || fn.Variadic && i == len(fn.Params)-1 {
+			t.optional++
+		}
+	}
+	if fn.ReturnType != nil {
+		t.result = c.resolve(fn.ReturnType)
+	} else if fn.Generator {
+		t.result = &generatorType{anyType}
+	}
+	return t
+}
+
+func (c *checker) functionLiteral(fn *ast.FunctionLiteral) typ {
+	t := c.signature(fn)
+
+	if fn.Variadic {
+		i := len(fn.Params) - 1
+		if rest := t.params[i]; !compatible(rest, &arrayType{anyType}) {
+			c.report(fn.Params[i].Token, "variadic parameter %s must be an array, not %s", fn.Params[i].Value, rest)
+		}
+	}
+
+	// defaults are evaluated outside the function
+	for i, p := range fn.Params {
+		if def := fn.ParamDefault(i); def != nil {
+			if dt := c.typed(def, t.params[i]); !compatible(dt, t.params[i]) {
+				c.report(start(def), "cannot use %s as %s in default of %s", dt, t.params[i], p.Value)
+			}
+		}
+	}
+
+	outer, outerFn := c.scope, c.fn
+	c.scope = &scope{vars: map[string]typ{}, outer: outer}
+	c.fn = &function{}
+	if fn.ReturnType != nil {
+		c.fn.declared = t.result
+	}
+	defer func() { c.scope, c.fn = outer, outerFn }()
+
+	if fn.Name != "" {
+		c.scope.vars[fn.Name] = t
+	}
+	for i, p := range fn.Params {
+		if pattern := fn.ParamPattern(i); pattern != nil {
+			c.destructure(pattern, t.params[i])
+			continue
+		}
+		c.scope.vars[p.Value] = t.params[i]
+	}
+
+	// the value of the last expression is returned implicitly
+	if n := len(fn.Body.Statements); n > 0 {
+		result := c.statements(fn.Body.Statements)
+		if last, ok := fn.Body.Statements[n-1].(*ast.ExpressionStatement); ok {
+			c.returned(last.Expression, result)
+		}
+	}
+
+	switch {
+	case fn.Generator:
+		// the values returned from generators are dropped
+		if fn.ReturnType == nil && c.fn.yields != nil {
+			t.result = &generatorType{c.fn.yields}
+		}
+	case fn.ReturnType == nil && c.fn.returns != nil:
+		t.result = c.fn.returns
+	}
+	return t
+}
+
+func (c *checker) call(e *ast.CallExpression) typ {
+	if ident, ok := e.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+		// quoted code isn't evaluated
+		return anyType
+	}
+
+	callee := c.expression(e.Function)
+	fn, _ := callee.(*funcType)
+	args := []typ{}
+	spread := false
+	for _, a := range e.Arguments {
+		s, ok := a.(*ast.SpreadExpression)
+		if !ok {
+			var param typ
+			if fn != nil && !spread {
+				param = fn.param(len(args))
+			}
+			t := c.typed(a, param)
+			if !spread {
+				args = append(args, t)
+			}
+			continue
+		}
+
+		// the arguments from here on aren't known
+		spread = true
+		if t := c.expression(s.Value); !compatible(t, &arrayType{anyType}) {
+			c.report(start(s.Value), "cannot spread %s", t)
+		}
+	}
+
+	if fn == nil {
+		if callee != anyType {
+			c.report(start(e.Function), "not a function: %s", callee)
+		}
+		return anyType
+	}
+
+	name := "function"
+	if ident, ok := e.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	}
+	for i, arg := range args {
+		if param := fn.param(i); param != nil && !compatible(arg, param) {
+			c.report(start(e.Arguments[i]), "cannot use %s as %s in argument %d to %s", arg, param, i+1, name)
+		}
+	}
+	return fn.result
+}
+
+func (c *checker) index(e *ast.IndexExpression) typ {
+	left, index := c.expression(e.Left), c.expression(e.Index)
+
+	switch left := left.(type) {
+	case *arrayType:
+		if !compatible(index, intType) {
+			c.report(start(e.Index), "cannot index %s with %s", left, index)
+		}
+		return left.elem
+	case *hashType:
+		if !compatible(index, left.key) {
+			c.report(start(e.Index), "cannot index %s with %s", left, index)
+		}
+		return left.value
+	}
+
+	switch left {
+	case anyType:
+		return anyType
+	case stringType:
+		if !compatible(index, intType) {
+			c.report(start(e.Index), "cannot index %s with %s", left, index)
+		}
+		return stringType
+	}
+	c.report(e.Token, "index operator not supported: %s", left)
+	return anyType
+}
+
+// resolve returns the type an annotation refers to.
+func (c *checker) resolve(annotation ast.TypeExpr) typ {
+	switch a := annotation.(type) {
+	case *ast.NamedType:
+		if t, ok := basicTypes[a.Name]; ok {
+			return t
+		}
+		if t, ok := c.records[a.Name]; ok {
+			return t
+		}
+		c.report(a.Token, "unknown type %s", a.Name)
+	case *ast.ArrayType:
+		return &arrayType{c.resolve(a.Element)}
+	case *ast.HashType:
+		return &hashType{c.resolve(a.Key), c.resolve(a.Value)}
+	case *ast.FunctionType:
+		t := &funcType{params: make([]typ, len(a.Params)), result: anyType}
+		for i, p := range a.Params {
+			t.params[i] = c.resolve(p)
+		}
+		if a.Return != nil {
+			t.result = c.resolve(a.Return)
+		}
+		return t
+	}
+	return anyType
+}
+
+func hashable(t typ) bool {
+	return t == intType || t == stringType || t == boolType || t == anyType
+}
+
+// start returns the first token of an expression.
+func start(e ast.Expression) token.Token {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return start(e.Left)
+	case *ast.CallExpression:
+		return start(e.Function)
+	case *ast.IndexExpression:
+		return start(e.Left)
+	case *ast.FieldExpression:
+		return start(e.Left)
+	case *ast.SpreadExpression:
+		return e.Token
+	case *ast.SliceExpression:
+		return start(e.Left)
+	case *ast.Identifier:
+		return e.Token
+	case *ast.IntegerLiteral:
+		return e.Token
+	case *ast.StringLiteral:
+		return e.Token
+	case *ast.InterpolatedString:
+		return e.Token
+	case *ast.Boolean:
+		return e.Token
+	case *ast.PrefixExpression:
+		return e.Token
+	case *ast.IfExpression:
+		return e.Token
+	case *ast.MatchExpression:
+		return e.Token
+	case *ast.FunctionLiteral:
+		return e.Token
+	case *ast.MacroLiteral:
+		return e.Token
+	case *ast.ArrayLiteral:
+		return e.Token
+	case *ast.HashLiteral:
+		return e.Token
+	case *ast.ImportExpression:
+		return e.Token
+	}
+	return token.Token{}
+}
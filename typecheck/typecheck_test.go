@@ -0,0 +1,161 @@
+package typecheck
+
+import (
+	"testing"
+
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`let add = fn(a: int, b: int) -> int { a + b }; let s: string = "n=" + "1"; add(len(s), 2) > 1;`,
+			nil,
+		},
+		{
+			`let x = fn(a, b) { a + b }; x(1, "s"); let xs: [int] = []; let h: {string: any} = {"a": 1}; h["a"]`,
+			nil,
+		},
+		{
+			`let x: int = "a"; let y: [string] = [1, 2];`,
+			[]string{"1:14: cannot assign string to x of type int", "1:37: cannot assign [int] to y of type [string]"},
+		},
+		{
+			"1 + \"a\";\n\"a\" - \"b\";\n-true;\n[1] == {};\n1 < \"2\";",
+			[]string{
+				"1:3: type mismatch: int + string",
+				"2:5: unknown operator: string - string",
+				"3:1: unknown operator: -bool",
+				"4:5: type mismatch: [int] == {any: any}",
+				"5:3: type mismatch: int < string",
+			},
+		},
+		{
+			"let f = fn(a: string, b: [int]) -> bool { len(b) > 0 };\nf(1, [\"x\"]);\nf(\"a\", [1]) + 1;",
+			[]string{
+				"2:3: cannot use int as string in argument 1 to f",
+				"2:6: cannot use [string] as [int] in argument 2 to f",
+				"3:13: type mismatch: bool + int",
+			},
+		},
+		{
+			"let fact = fn(n: int) -> int {\n  if (n < 2) { return \"one\"; }\n  n * fact(n - 1)\n};\nlet g = fn() -> string { 1 };",
+			[]string{
+				"2:23: cannot return string from a function returning int",
+				"5:26: cannot return int from a function returning string",
+			},
+		},
+		{
+			"let inc = fn(x) { x + 1 };\nlet n = inc(1);\nn + \"s\";\nlet words = split(\"a b\", \" \");\nwords[0] - 1;",
+			[]string{"3:3: type mismatch: int + string", "5:10: type mismatch: string - int"},
+		},
+		{
+			"let h = {\"a\": [1]};\nh[1];\nh[\"a\"][\"b\"];\n5[0];\n{[1]: 2};\n1();",
+			[]string{
+				"2:3: cannot index {string: [int]} with int",
+				"3:8: cannot index [int] with string",
+				"4:2: index operator not supported: int",
+				"5:2: unusable as hash key: [int]",
+				"6:1: not a function: int",
+			},
+		},
+		{
+			"let apply = fn(f: fn(int) -> int, x: int) -> int { f(x) };\napply(fn(s: string) -> string { s }, 1);\nlet y: strin = 1;",
+			[]string{
+				"2:7: cannot use fn(string) -> string as fn(int) -> int in argument 1 to apply",
+				"3:8: unknown type strin",
+			},
+		},
+		{
+			"let v = match ([1, 2]) { [a, ...r] => a + len(r) };\nv + 1;\nlet h = {\"k\": \"s\"};\nmatch (h) { {\"k\": s} => s - 1 };\nlet w: int = match (1) { 1 => 2 };",
+			[]string{"4:27: type mismatch: string - int"},
+		},
+		{
+			"let [a, ...r] = [1, 2];\na + r;\nlet {k}: {string: string} = {};\nk - 1;\nlet [x] = 1;\nlet f = fn({h}: int) { h };",
+			[]string{
+				"2:3: type mismatch: int + [int]",
+				"4:3: type mismatch: string - int",
+				"5:5: cannot destructure int as an array",
+				"6:12: cannot destructure int as a hash",
+			},
+		},
+		{
+			"let g = fn() { yield \"s\"; };\nlet [a, ...r] = g();\na - 1;\nr + 1;",
+			[]string{
+				"3:3: type mismatch: string - int",
+				"4:3: type mismatch: [string] + int",
+			},
+		},
+		{
+			"let f = fn(a: int, b: string = 1, ...rest: [bool]) { a };\nf(1, \"s\", true, 2);\nf(...[1]);\nf(1, ...2);\nlet g: fn(int) -> any = f;\nlet h = fn(...xs: int) { xs };",
+			[]string{
+				"1:32: cannot use int as string in default of b",
+				"2:17: cannot use int as bool in argument 4 to f",
+				"4:9: cannot spread int",
+				"6:15: variadic parameter xs must be an array, not int",
+			},
+		},
+		{
+			"for (i, x in [\"a\"]) { i + x }\nfor (k in {\"a\": 1}) { k - 1 }\nfor (c in \"ab\") { c * 2 }\nfor (x in 5) {}\nlet f = fn(xs) { for (x in xs) { x + 1 } };",
+			[]string{
+				"1:25: type mismatch: int + string",
+				"2:25: type mismatch: string - int",
+				"3:21: type mismatch: string * int",
+				"4:11: cannot iterate over int",
+			},
+		},
+		{
+			"struct P { x, fn get(p) { p.x } }\nlet p: P = P(1);\np.x + p.get();\np.z;\nlet n: int = P(1);\n1.x;\nP(1, 2);",
+			[]string{
+				"4:3: P has no field or method z",
+				"5:14: cannot assign P to n of type int",
+				"6:2: field access not supported: int",
+			},
+		},
+		{
+			"let g = fn() { yield 1; yield 2; return \"s\"; };\nfor (i, x in g()) { x + \"a\" }\ng().next() - 1;\ng().peek;\nlet s: string = g();",
+			[]string{
+				"2:23: type mismatch: int + string",
+				"4:5: generator(int) has no field or method peek",
+				"5:17: cannot assign generator(int) to s of type string",
+			},
+		},
+		{
+			"let r: [int] = [1, \"a\"];\nlet m: [[int]] = [[1], [\"x\", 2]];\nlet h: {string: int} = {\"a\": 1, \"b\": true};\nlet g = fn(xs: [int]) { xs }; g([1, \"a\"]);\nlet k = fn() -> [string] { return [\"s\", 1]; };",
+			[]string{
+				"1:20: cannot use string as int in element 2 of [int]",
+				"2:25: cannot use string as int in element 1 of [int]",
+				"3:38: cannot use bool as int in value of {string: int}",
+				"4:37: cannot use string as int in element 2 of [int]",
+				"5:41: cannot use int as string in element 2 of [string]",
+			},
+		},
+		{
+			`"${1 + true}"`,
+			[]string{"1:1: type mismatch: int + bool"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		diagnostics := Check(program)
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong diagnostics for %q. want=%q, got=%q", tt.input, tt.expected, diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("wrong diagnostic %d for %q. want=%q, got=%q", i, tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// Package vet reports likely mistakes in Monkey programs without running
+// them. Names are resolved in the same scopes and order as the compiler
+// resolves them, starting out with the prelude and the builtins.
+package vet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/object"
+	"monkey/prelude"
+	"monkey/token"
+)
+
+// Diagnostic is a problem found at a position in the source.
+type Diagnostic struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Check reports undefined names, unused local variables and parameters,
+// names shadowing builtins, unreachable statements and calls with the wrong
+// number of arguments, ordered by position. The program must have parsed
+// without errors. Unused names starting with an underscore aren't reported,
+// neither are unused globals as other modules may import them.
+func Check(program *ast.Program) []Diagnostic {
+	c := &checker{table: compiler.NewSymbolTableFrom(prelude.Load().SymbolTable)}
+	c.bindings = map[*compiler.SymbolTable]map[string]*binding{c.table: {}}
+	c.walk(program)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+// binding is a name defined by the program.
+type binding struct {
+	ident *ast.Identifier
+	kind  string // "variable", "parameter" or "struct"
+	used  bool
+	fn    *ast.FunctionLiteral // the function it's bound to, if known
+	rt    *ast.StructStatement // the record type it's bound to, if known
+}
+
+type checker struct {
+	table       *compiler.SymbolTable
+	bindings    map[*compiler.SymbolTable]map[string]*binding
+	locals      [][]*binding // the bindings of each enclosing function
+	diagnostics []Diagnostic
+
+	// within interpolations positions are relative to the embedded
+	// expression, so they're reported at the string instead
+	template *token.Token
+}
+
+func (c *checker) report(tok token.Token, format string, a ...interface{}) {
+	if c.template != nil {
+		tok = *c.template
+	}
+	c.diagnostics = append(c.diagnostics, Diagnostic{Message: fmt.Sprintf(format, a...), Line: tok.Line, Column: tok.Column})
+}
+
+func (c *checker) walk(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		c.statements(node.Statements)
+
+	case *ast.BlockStatement:
+		c.statements(node.Statements)
+
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			c.walk(node.Value)
+			c.pattern(node.Pattern, "variable")
+			return
+		}
+
+		// defined first, like the compiler does for recursive closures
+		b := c.define(node.Name, "variable")
+		b.fn, _ = node.Value.(*ast.FunctionLiteral)
+		c.walk(node.Value)
+
+	case *ast.StructStatement:
+		// defined first so methods can refer to the type
+		b := c.define(node.Name, "struct")
+		b.rt = node
+		for _, m := range node.Methods {
+			c.walk(m.Function)
+		}
+
+	case *ast.ForStatement:
+		c.walk(node.Iterable)
+		c.block(func() {
+			if node.Key != nil {
+				c.define(node.Key, "variable")
+			}
+			c.define(node.Value, "variable")
+			c.walk(node.Body)
+		})
+
+	case *ast.ReturnStatement:
+		c.walk(node.ReturnValue)
+
+	case *ast.YieldStatement:
+		c.walk(node.Value)
+
+	case *ast.ExpressionStatement:
+		c.walk(node.Expression)
+
+	case *ast.Identifier:
+		c.use(node)
+
+	case *ast.PrefixExpression:
+		c.walk(node.Right)
+
+	case *ast.InfixExpression:
+		c.walk(node.Left)
+		c.walk(node.Right)
+
+	case *ast.IfExpression:
+		c.walk(node.Condition)
+		c.walk(node.Consequence)
+		if node.Alternative != nil {
+			c.walk(node.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		// defaults are evaluated outside the function
+		for _, d := range node.Defaults {
+			if d != nil {
+				c.walk(d)
+			}
+		}
+		c.function(node.Name, node.Params, node.ParamPatterns, node.Body)
+
+	case *ast.MacroLiteral:
+		c.function("", node.Params, nil, node.Body)
+
+	case *ast.CallExpression:
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			c.quote(node)
+			return
+		}
+		c.walk(node.Function)
+		for _, a := range node.Arguments {
+			c.walk(a)
+		}
+		c.checkArity(node)
+
+	case *ast.SpreadExpression:
+		c.walk(node.Value)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			c.walk(el)
+		}
+
+	case *ast.HashLiteral:
+		for _, k := range node.Keys {
+			c.walk(k)
+			c.walk(node.Pairs[k])
+		}
+
+	case *ast.IndexExpression:
+		c.walk(node.Left)
+		c.walk(node.Index)
+
+	case *ast.FieldExpression:
+		c.walk(node.Left)
+
+	case *ast.SliceExpression:
+		c.walk(node.Left)
+		if node.Start != nil {
+			c.walk(node.Start)
+		}
+		if node.End != nil {
+			c.walk(node.End)
+		}
+
+	case *ast.MatchExpression:
+		c.walk(node.Value)
+		for _, arm := range node.Arms {
+			arm := arm
+			c.block(func() {
+				c.pattern(arm.Pattern, "variable")
+				if arm.Guard != nil {
+					c.walk(arm.Guard)
+				}
+				c.walk(arm.Body)
+			})
+		}
+
+	case *ast.InterpolatedString:
+		if c.template == nil {
+			c.template = &node.Token
+			defer func() { c.template = nil }()
+		}
+		for _, p := range node.Parts {
+			c.walk(p)
+		}
+	}
+}
+
+// statements walks a sequence of statements, reporting the first one that
+// follows a return.
+func (c *checker) statements(stmts []ast.Statement) {
+	returned := false
+	for _, s := range stmts {
+		if returned {
+			c.report(statementToken(s), "unreachable code")
+			returned = false
+		}
+		if _, ok := s.(*ast.ReturnStatement); ok {
+			returned = true
+		}
+		c.walk(s)
+	}
+}
+
+func (c *checker) function(name string, params []*ast.Identifier, patterns []ast.Pattern, body *ast.BlockStatement) {
+	c.table = compiler.NewEnclosedSymbolTable(c.table)
+	c.bindings[c.table] = map[string]*binding{}
+	c.locals = append(c.locals, nil)
+
+	if name != "" {
+		c.table.DefineFunctionName(name)
+	}
+	for i, p := range params {
+		if i < len(patterns) && patterns[i] != nil {
+			// the argument is bound to the pattern's names instead
+			c.table.Define(p.Value)
+			c.pattern(patterns[i], "parameter")
+			continue
+		}
+		c.define(p, "parameter")
+	}
+	c.walk(body)
+
+	for _, b := range c.locals[len(c.locals)-1] {
+		if !b.used && !strings.HasPrefix(b.ident.Value, "_") {
+			c.report(b.ident.Token, "%s %s is unused", b.kind, b.ident.Value)
+		}
+	}
+	c.locals = c.locals[:len(c.locals)-1]
+	c.table = c.table.Outer
+}
+
+// block runs walk in a block scope, see compiler.NewBlockSymbolTable.
+func (c *checker) block(walk func()) {
+	c.table = compiler.NewBlockSymbolTable(c.table)
+	c.bindings[c.table] = map[string]*binding{}
+	walk()
+	c.table = c.table.Outer
+}
+
+// pattern defines the names a pattern binds.
+func (c *checker) pattern(pattern ast.Pattern, kind string) {
+	for _, name := range ast.PatternNames(pattern) {
+		c.define(name, kind)
+	}
+}
+
+// quote walks the unquoted expressions of a quote call, the rest isn't
+// evaluated.
+func (c *checker) quote(call *ast.CallExpression) {
+	for _, a := range call.Arguments {
+		ast.Modify(a, func(node ast.Node) ast.Node {
+			if call, ok := node.(*ast.CallExpression); ok && call.Function.TokenLiteral() == "unquote" {
+				for _, a := range call.Arguments {
+					c.walk(a)
+				}
+			}
+			return node
+		})
+	}
+}
+
+func (c *checker) define(ident *ast.Identifier, kind string) *binding {
+	if sym, ok := c.table.Resolve(ident.Value); ok && sym.Scope == compiler.BuiltinScope {
+		c.report(ident.Token, "%s %s shadows the builtin %s", kind, ident.Value, ident.Value)
+	}
+
+	b := &binding{ident: ident, kind: kind}
+	c.table.Define(ident.Value)
+	c.bindings[c.table][ident.Value] = b
+	if len(c.locals) > 0 {
+		c.locals[len(c.locals)-1] = append(c.locals[len(c.locals)-1], b)
+	}
+	return b
+}
+
+func (c *checker) use(ident *ast.Identifier) {
+	if _, ok := c.table.Resolve(ident.Value); !ok {
+		c.report(ident.Token, "undefined variable %s", ident.Value)
+		return
+	}
+	if b := c.lookup(ident.Value); b != nil {
+		b.used = true
+	}
+}
+
+// lookup returns the binding a name refers to, nil if it isn't defined by
+// the program.
+func (c *checker) lookup(name string) *binding {
+	for t := c.table; t != nil; t = t.Outer {
+		if b, ok := c.bindings[t][name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// checkArity reports calls of functions whose parameters are known with a
+// number of arguments they don't take. Calls spreading arguments aren't
+// checked.
+func (c *checker) checkArity(call *ast.CallExpression) {
+	for _, a := range call.Arguments {
+		if _, ok := a.(*ast.SpreadExpression); ok {
+			return
+		}
+	}
+
+	name, fn := "", (*object.CompiledFunction)(nil)
+	tok := call.Token
+
+	switch callee := call.Function.(type) {
+	case *ast.FunctionLiteral:
+		fn, tok = arity(callee), callee.Token
+	case *ast.Identifier:
+		name, tok = " to "+callee.Value, callee.Token
+		if b := c.lookup(callee.Value); b != nil {
+			if b.fn != nil {
+				fn = arity(b.fn)
+			} else if b.rt != nil {
+				// constructors take the fields
+				fn = &object.CompiledFunction{NumParams: len(b.rt.Fields)}
+			}
+		} else if sym, ok := c.table.Resolve(callee.Value); ok && sym.Scope == compiler.GlobalScope {
+			fn = preludeFunction(sym.Index)
+		}
+	}
+	if fn == nil {
+		return
+	}
+
+	// the defaults' values don't matter, only how many there are
+	defaults := make([]object.Object, fn.NumDefaults)
+	args := make([]object.Object, len(call.Arguments))
+	if _, err := object.BindArgs(fn.NumParams, defaults, fn.Variadic, args); err != nil {
+		c.report(tok, "%s", strings.Replace(err.Error(), ":", name+":", 1))
+	}
+}
+
+// arity describes the parameters of a function literal the way the
+// compiler does.
+func arity(fn *ast.FunctionLiteral) *object.CompiledFunction {
+	numDefaults := 0
+	for _, d := range fn.Defaults {
+		if d != nil {
+			numDefaults++
+		}
+	}
+	return &object.CompiledFunction{NumParams: len(fn.Params), NumDefaults: numDefaults, Variadic: fn.Variadic}
+}
+
+// preludeFunction returns the prelude function in the global slot, or nil.
+func preludeFunction(index int) *object.CompiledFunction {
+	globals := prelude.Load().Globals
+	if index < len(globals) {
+		if cl, ok := globals[index].(*object.Closure); ok {
+			return cl.Fn
+		}
+	}
+	return nil
+}
+
+func statementToken(s ast.Statement) token.Token {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.ExpressionStatement:
+		return s.Token
+	case *ast.StructStatement:
+		return s.Token
+	case *ast.ForStatement:
+		return s.Token
+	case *ast.YieldStatement:
+		return s.Token
+	}
+	return token.Token{}
+}
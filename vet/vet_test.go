@@ -0,0 +1,112 @@
+package vet
+
+import (
+	"testing"
+
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`let add = fn(a, b) { a + b }; puts(add(1, 2), sum([1]));`,
+			nil,
+		},
+		{
+			"let x = y;\nputs(\"${z}\");",
+			[]string{"1:9: undefined variable y", "2:6: undefined variable z"},
+		},
+		{
+			"let f = fn(a, b, _c) {\n  let unused = 1;\n  a\n};",
+			[]string{"1:15: parameter b is unused", "2:7: variable unused is unused"},
+		},
+		{
+			"let g = 1; let h = fn() { let len = 1; len };\nlet puts = fn(v) { v };",
+			[]string{"1:31: variable len shadows the builtin len", "2:5: variable puts shadows the builtin puts"},
+		},
+		{
+			"let f = fn(x) {\n  return x;\n  puts(x);\n  puts(x);\n};",
+			[]string{"3:3: unreachable code"},
+		},
+		{
+			"let f = fn(x, y) { x + y };\nf(1);\nfn(x) { x }(1, 2);\nmax([1], 2);\nlen(1, 2);",
+			[]string{
+				"2:1: wrong number of arguments to f: want=2, got=1",
+				"3:1: wrong number of arguments: want=1, got=2",
+				"4:1: wrong number of arguments to max: want=1, got=2",
+			},
+		},
+		{
+			"let f = fn(x, y = x, ...zs) { [x, y, zs] };\nf(1);\nf(1, 2, 3, 4);\nf();\nf(...[]);\nfn(a = 1) { a }(1, 2);",
+			[]string{
+				"1:19: undefined variable x",
+				"4:1: wrong number of arguments to f: want=1 or more, got=0",
+				"6:1: wrong number of arguments: want=0 to 1, got=2",
+			},
+		},
+		{
+			"struct P { x, fn get(p, unused) { p.x + q } }\nP(1, 2);\nlet f = fn() { struct L { v } 1 };",
+			[]string{
+				"1:25: parameter unused is unused",
+				"1:41: undefined variable q",
+				"2:1: wrong number of arguments to P: want=1, got=2",
+				"3:23: struct L is unused",
+			},
+		},
+		{
+			"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1, 1) } };",
+			[]string{"1:48: wrong number of arguments to fact: want=1, got=2"},
+		},
+		{
+			"let f = fn(v) {\n  match (v) { [x, ...xs] if x > 0 => xs, {\"k\": y} => z, _ => 0 }\n};",
+			[]string{"2:48: variable y is unused", "2:54: undefined variable z"},
+		},
+		{
+			"let f = fn(v) {\n  match (v) { [a, 3] => a, _ => a }\n};\nmatch (1) { x => x };\nx;",
+			[]string{"2:33: undefined variable a", "5:1: undefined variable x"},
+		},
+		{
+			"let [a, ...xs] = [1];\nlet f = fn([x, y], {z}) {\n  let {w} = z;\n  x\n};\nputs(a, xs, q);",
+			[]string{"2:16: parameter y is unused", "3:8: variable w is unused", "6:13: undefined variable q"},
+		},
+		{
+			"let f = fn(h) {\n  for (k, v in h) { puts(v, x) }\n  for (i in range(3)) { return i; puts(i) }\n};",
+			[]string{"2:8: variable k is unused", "2:29: undefined variable x", "3:35: unreachable code"},
+		},
+		{
+			"for (x in [1]) { puts(x) }\nputs(x);",
+			[]string{"2:6: undefined variable x"},
+		},
+		{
+			"let g = fn() {\n  yield n;\n  return 1;\n  yield 2;\n};",
+			[]string{"2:9: undefined variable n", "4:3: unreachable code"},
+		},
+		{
+			`let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }) };`,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		diagnostics := Check(program)
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong diagnostics for %q. want=%q, got=%q", tt.input, tt.expected, diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("wrong diagnostic %d for %q. want=%q, got=%q", i, tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
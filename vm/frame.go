@@ -9,6 +9,7 @@ type Frame struct {
 	cl      *object.Closure
 	ip      int
 	basePtr int
+	gen     *generator // set if the frame runs the body of a generator
 }
 
 func NewFrame(cl *object.Closure, basePtr int) *Frame {
@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"fmt"
+
+	"monkey/object"
+)
+
+// generator is a suspended call of a generator function: its frame along
+// with its slice of the value stack, the locals and whatever else the frame
+// had pushed. Resuming puts both back on top of the stack and runs the frame
+// until it yields or returns.
+type generator struct {
+	frame *Frame
+	stack []object.Object
+	done  bool
+}
+
+// newGenerator replaces the closure and its numArgs arguments on the stack
+// with a generator that runs the closure's body once resumed.
+func (vm *VM) newGenerator(cl *object.Closure, numArgs int) error {
+	g := &generator{frame: NewFrame(cl, 0), stack: make([]object.Object, cl.Fn.NumLocals)}
+	g.frame.gen = g
+	copy(g.stack, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp -= numArgs + 1
+
+	return vm.push(object.NewGenerator(func() (object.Object, error) {
+		return vm.resume(g)
+	}))
+}
+
+// resume runs the generator on top of the current stack until it yields,
+// and returns the value yielded or nil once it has returned.
+func (vm *VM) resume(g *generator) (object.Object, error) {
+	if g.done {
+		return nil, nil
+	}
+
+	sp, framesIndex := vm.sp, vm.framesIndex
+	if vm.sp+1+len(g.stack) > StackSize {
+		return nil, fmt.Errorf("stack overflow")
+	}
+
+	// the frame's slice sits above a slot for the result, as if the
+	// generator had been called
+	vm.stack[vm.sp] = Null
+	g.frame.basePtr = vm.sp + 1
+	copy(vm.stack[g.frame.basePtr:], g.stack)
+	vm.sp = g.frame.basePtr + len(g.stack)
+	vm.pushFrame(g.frame)
+
+	if err := vm.run(framesIndex); err != nil {
+		vm.sp, vm.framesIndex = sp, framesIndex
+		g.done = true
+		return nil, err
+	}
+
+	value := vm.pop()
+	if g.done {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// suspend saves the current frame, which runs a generator, along with its
+// slice of the stack and returns from it with value as the result.
+func (vm *VM) suspend(value object.Object) error {
+	frame := vm.popFrame()
+	if frame.gen == nil {
+		return fmt.Errorf("yield outside a generator")
+	}
+
+	frame.gen.stack = append(frame.gen.stack[:0], vm.stack[frame.basePtr:vm.sp]...)
+	vm.sp = frame.basePtr - 1
+	return vm.push(value)
+}
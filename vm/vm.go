@@ -2,6 +2,7 @@ package vm
 
 import (
 	"fmt"
+	"strings"
 
 	"monkey/code"
 	"monkey/compiler"
@@ -15,9 +16,9 @@ const (
 )
 
 var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
-	Null  = &object.Null{}
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
 )
 
 type VM struct {
@@ -27,6 +28,9 @@ type VM struct {
 	globals     []object.Object
 	frames      []*Frame
 	framesIndex int
+	host        *object.Host
+	modules     map[int]object.Object // namespaces of the modules run so far
+	globalNames []string
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
@@ -42,6 +46,9 @@ func New(bytecode *compiler.Bytecode) *VM {
 		constants:   bytecode.Constants,
 		frames:      frames,
 		framesIndex: 1,
+		host:        object.DefaultHost(),
+		modules:     map[int]object.Object{},
+		globalNames: bytecode.GlobalNames,
 	}
 }
 
@@ -51,6 +58,19 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *
 	return vm
 }
 
+// SetHost makes the program do its I/O through host instead of the process'
+// standard streams.
+func (vm *VM) SetHost(host *object.Host) {
+	vm.host = host
+}
+
+// SetModules makes the VM share the namespaces of the modules run so far,
+// keyed by the constant index of their bodies, with modules, e.g. across the
+// lines of a REPL session.
+func (vm *VM) SetModules(modules map[int]object.Object) {
+	vm.modules = modules
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -63,10 +83,16 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 }
 
 func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// run executes instructions until the main function is done or, when called
+// re-entrantly from a builtin, until the number of frames drops to minFrames.
+func (vm *VM) run(minFrames int) error {
 	var ip int
 	var ins code.Instructions
 
-	for vm.curFrame().ip < len(vm.curFrame().Instructions())-1 {
+	for vm.framesIndex > minFrames && vm.curFrame().ip < len(vm.curFrame().Instructions())-1 {
 		vm.curFrame().ip++
 
 		ip = vm.curFrame().ip
@@ -89,7 +115,13 @@ func (vm *VM) Run() error {
 		case code.OpGetGlobal:
 			globalIdx := code.ReadUint16(ins[ip+1:])
 			vm.curFrame().ip += 2
-			err := vm.push(vm.globals[globalIdx])
+
+			global := vm.globals[globalIdx]
+			if global == nil {
+				return vm.unsetGlobal(int(globalIdx))
+			}
+
+			err := vm.push(global)
 			if err != nil {
 				return err
 			}
@@ -126,6 +158,15 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.curFrame().ip += 2
+
+			err := vm.executeImport(int(constIndex))
+			if err != nil {
+				return err
+			}
+
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
@@ -171,30 +212,87 @@ func (vm *VM) Run() error {
 			numArgs := int(code.ReadUint8(ins[ip+1:]))
 			vm.curFrame().ip += 1
 
-			fn := vm.stack[vm.sp-1-numArgs]
-			switch callee := fn.(type) {
-			case *object.Closure:
-				if numArgs != callee.Fn.NumParams {
-					return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Fn.NumParams, numArgs)
-				}
+			if err := vm.executeCall(numArgs); err != nil {
+				return err
+			}
+
+		case code.OpCallSpread:
+			numArrays := int(code.ReadUint8(ins[ip+1:]))
+			vm.curFrame().ip += 1
+
+			if err := vm.executeSpreadCall(numArrays); err != nil {
+				return err
+			}
 
-				frame := NewFrame(callee, vm.sp-numArgs)
-				vm.pushFrame(frame)
-				vm.sp = frame.basePtr + callee.Fn.NumLocals
+		case code.OpStruct:
+			constIdx := code.ReadUint16(ins[ip+1:])
+			numMethods := int(code.ReadUint8(ins[ip+3:]))
+			vm.curFrame().ip += 3
 
-			case *object.Builtin:
-				args := vm.stack[vm.sp-numArgs : vm.sp]
-				result := callee.Fn(args...)
-				vm.sp -= numArgs + 1
+			template, ok := vm.constants[constIdx].(*object.RecordType)
+			if !ok {
+				return fmt.Errorf("not a record type: %+v", vm.constants[constIdx])
+			}
 
-				if result != nil {
-					vm.push(result)
-				} else {
-					vm.push(Null)
+			rt := &object.RecordType{Name: template.Name, Fields: template.Fields, Methods: map[string]object.Object{}}
+			for i := vm.sp - 2*numMethods; i < vm.sp; i += 2 {
+				rt.Methods[vm.stack[i].(*object.String).Value] = vm.stack[i+1]
+			}
+			vm.sp -= 2 * numMethods
+
+			if err := vm.push(rt); err != nil {
+				return err
+			}
+
+		case code.OpField:
+			constIdx := code.ReadUint16(ins[ip+1:])
+			vm.curFrame().ip += 2
+
+			field, err := object.GetField(vm.pop(), vm.constants[constIdx].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+			if err := vm.push(field); err != nil {
+				return err
+			}
+
+		case code.OpIter:
+			vars := code.ReadUint8(ins[ip+1:])
+			vm.curFrame().ip += 1
+
+			iterator, err := object.Iterate(vm.pop(), vars == 1)
+			if err != nil {
+				return err
+			}
+			if err := vm.push(iterator); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vars := code.ReadUint8(ins[ip+3:])
+			vm.curFrame().ip += 3
+
+			key, value, err := vm.pop().(object.Iterator).Next()
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				vm.curFrame().ip = pos - 1
+				break
+			}
+			if vars == 2 {
+				if err := vm.push(key); err != nil {
+					return err
 				}
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
 
-			default:
-				return fmt.Errorf("calling non-closure and non-built-in")
+		case code.OpYield:
+			if err := vm.suspend(vm.pop()); err != nil {
+				return err
 			}
 
 		case code.OpClosure:
@@ -215,7 +313,11 @@ func (vm *VM) Run() error {
 			copy(free, vm.stack[vm.sp-numFree:]) // copy free variables for closure from the stack
 			vm.sp -= numFree                     // clean the stack
 
-			closure := &object.Closure{Fn: fn, Free: free}
+			defaults := make([]object.Object, fn.NumDefaults)
+			copy(defaults, vm.stack[vm.sp-fn.NumDefaults:])
+			vm.sp -= fn.NumDefaults
+
+			closure := &object.Closure{Fn: fn, Free: free, Defaults: defaults}
 			err := vm.push(closure)
 			if err != nil {
 				return err
@@ -226,6 +328,9 @@ func (vm *VM) Run() error {
 
 			frame := vm.popFrame()
 			vm.sp = frame.basePtr - 1
+			if frame.gen != nil {
+				frame.gen.done = true
+			}
 
 			err := vm.push(returnValue)
 			if err != nil {
@@ -235,6 +340,9 @@ func (vm *VM) Run() error {
 		case code.OpReturn:
 			frame := vm.popFrame()
 			vm.sp = frame.basePtr - 1
+			if frame.gen != nil {
+				frame.gen.done = true
+			}
 
 			err := vm.push(Null)
 			if err != nil {
@@ -297,22 +405,243 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.curFrame().ip += 2
+
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				out.WriteString(part.Inspect())
+			}
+
+			vm.sp -= numParts
+
+			if err := vm.push(&object.String{Value: out.String()}); err != nil {
+				return err
+			}
+
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
 			if err := vm.executeIndexExpression(left, index); err != nil {
 				return err
 			}
+
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.curFrame().ip += 3
+
+			array, ok := vm.pop().(*object.Array)
+			matched := ok && (len(array.Elements) == length || rest && len(array.Elements) > length)
+			if err := vm.push(nativeBoolToBooleanObject(matched)); err != nil {
+				return err
+			}
+
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.curFrame().ip += 2
+
+			keys := vm.stack[vm.sp-numKeys : vm.sp]
+			hash, matched := vm.stack[vm.sp-numKeys-1].(*object.Hash)
+			for _, key := range keys {
+				if !matched {
+					break
+				}
+				if key, ok := key.(object.Hashable); ok {
+					_, matched = hash.Get(key.HashKey())
+				} else {
+					matched = false
+				}
+			}
+			vm.sp -= numKeys + 1
+
+			if err := vm.push(nativeBoolToBooleanObject(matched)); err != nil {
+				return err
+			}
+
+		case code.OpDestructureArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.curFrame().ip += 3
+
+			array, err := object.DestructureArray(vm.pop(), length, rest)
+			if err != nil {
+				return err
+			}
+			if err := vm.push(array); err != nil {
+				return err
+			}
+
+		case code.OpDestructureHash:
+			if value := vm.pop(); value.Type() != object.HASH_OBJ {
+				return fmt.Errorf("cannot destructure %s as %s", value.Type(), object.HASH_OBJ)
+			}
+
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			slice, err := object.Slice(left, start, end)
+			if err != nil {
+				return err
+			}
+			if err := vm.push(slice); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// executeCall calls the function sitting on the stack below its numArgs
+// arguments. Closures get a new frame, builtins are run right away.
+func (vm *VM) executeCall(numArgs int) error {
+	fn := vm.stack[vm.sp-1-numArgs]
+	switch callee := fn.(type) {
+	case *object.Closure:
+		if numArgs != callee.Fn.NumParams || callee.Fn.Variadic {
+			args, err := object.BindArgs(callee.Fn.NumParams, callee.Defaults, callee.Fn.Variadic, vm.stack[vm.sp-numArgs:vm.sp])
+			if err != nil {
+				return err
+			}
+			if vm.sp-numArgs+len(args) > StackSize {
+				return fmt.Errorf("stack overflow")
+			}
+			copy(vm.stack[vm.sp-numArgs:], args)
+			vm.sp, numArgs = vm.sp-numArgs+len(args), len(args)
+		}
+
+		if callee.Fn.Generator {
+			return vm.newGenerator(callee, numArgs)
+		}
+
+		frame := NewFrame(callee, vm.sp-numArgs)
+		vm.pushFrame(frame)
+		vm.sp = frame.basePtr + callee.Fn.NumLocals
+		return nil
+
+	case *object.RecordType:
+		record, err := callee.New(vm.stack[vm.sp-numArgs : vm.sp])
+		if err != nil {
+			return err
+		}
+		vm.sp -= numArgs + 1
+		return vm.push(record)
+
+	case *object.BoundMethod:
+		// call the method with the receiver inserted before the arguments
+		if vm.sp >= StackSize {
+			return fmt.Errorf("stack overflow")
+		}
+		base := vm.sp - numArgs - 1
+		copy(vm.stack[base+2:], vm.stack[base+1:vm.sp])
+		vm.stack[base], vm.stack[base+1] = callee.Method, callee.Receiver
+		vm.sp++
+		return vm.executeCall(numArgs + 1)
+
+	case *object.Builtin:
+		// sp stays above the args until the builtin returns, so callbacks
+		// into the VM can't overwrite them
+		args := vm.stack[vm.sp-numArgs : vm.sp]
+		result := callee.Fn(vm, args...)
+		vm.sp -= numArgs + 1
+
+		if result != nil {
+			return vm.push(result)
+		}
+		return vm.push(Null)
+
+	default:
+		return fmt.Errorf("calling non-closure and non-built-in")
+	}
+}
+
+// executeSpreadCall calls the function sitting on the stack below numArrays
+// arrays, with their elements as the arguments.
+func (vm *VM) executeSpreadCall(numArrays int) error {
+	base := vm.sp - numArrays
+	arrays := make([]object.Object, numArrays)
+	copy(arrays, vm.stack[base:vm.sp])
+	vm.sp = base
+
+	numArgs := 0
+	for _, a := range arrays {
+		array, ok := a.(*object.Array)
+		if !ok {
+			return fmt.Errorf("cannot spread %s", a.Type())
+		}
+		for _, el := range array.Elements {
+			if err := vm.push(el); err != nil {
+				return err
+			}
+		}
+		numArgs += len(array.Elements)
+	}
+
+	return vm.executeCall(numArgs)
+}
+
+// Call implements object.Runtime. It runs fn to completion on top of the
+// current stack, so builtins can call back into Monkey functions.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	sp, framesIndex := vm.sp, vm.framesIndex
+
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		err = vm.push(arg)
+	}
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	if err == nil && vm.framesIndex > framesIndex {
+		err = vm.run(framesIndex)
+	}
+
+	if err != nil {
+		vm.sp, vm.framesIndex = sp, framesIndex
+		return &object.Error{Message: err.Error()}
+	}
+
+	return vm.pop()
+}
+
+// executeImport pushes the namespace of a module, running its body the first
+// time it's imported.
+func (vm *VM) executeImport(constIndex int) error {
+	module, ok := vm.modules[constIndex]
+	if !ok {
+		body, ok := vm.constants[constIndex].(*object.CompiledFunction)
+		if !ok {
+			return fmt.Errorf("not a module: %+v", vm.constants[constIndex])
+		}
+
+		module = vm.Call(&object.Closure{Fn: body})
+		if err, ok := module.(*object.Error); ok {
+			return fmt.Errorf("%s", err.Message)
+		}
+		vm.modules[constIndex] = module
+	}
+
+	return vm.push(module)
+}
+
+// Host implements object.Runtime.
+func (vm *VM) Host() *object.Host {
+	return vm.host
+}
+
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -325,6 +654,11 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	i := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
+	if i < 0 {
+		// negative indices count from the end
+		i += max + 1
+	}
+
 	if i < 0 || i > max {
 		return vm.push(Null)
 	}
@@ -332,6 +666,22 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	return vm.push(arrayObject.Elements[i])
 }
 
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	chars := []rune(str.(*object.String).Value)
+	i := index.(*object.Integer).Value
+	max := int64(len(chars) - 1)
+
+	if i < 0 {
+		i += max + 1
+	}
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: string(chars[i])})
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -339,7 +689,7 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(key.HashKey())
 	if !ok {
 		return vm.push(Null)
 	}
@@ -347,7 +697,7 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 }
 
 func (vm *VM) buildHash(start, end int) (*object.Hash, error) {
-	hashedPairs := map[object.HashKey]object.HashPair{}
+	hash := object.NewHash()
 	for i := start; i < end; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
@@ -358,10 +708,10 @@ func (vm *VM) buildHash(start, end int) (*object.Hash, error) {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey.HashKey(), pair)
 	}
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) executeComparison(op code.Opcode) error {
@@ -386,9 +736,9 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
 	}
@@ -507,3 +857,12 @@ func isTruthy(obj object.Object) bool {
 		return true
 	}
 }
+
+// unsetGlobal returns the error for reading the global at index before a
+// value was assigned to it, e.g. after its definition failed.
+func (vm *VM) unsetGlobal(index int) error {
+	if index < len(vm.globalNames) {
+		return fmt.Errorf("variable %s used before being set", vm.globalNames[index])
+	}
+	return fmt.Errorf("variable used before being set")
+}
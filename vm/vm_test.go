@@ -1,9 +1,14 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"monkey/code"
 	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
@@ -65,6 +70,14 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!!false", false},
 		{"!!5", true},
 		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} != {"b": 1}`, true},
 	}
 
 	runVmTests(t, tests)
@@ -92,6 +105,7 @@ func TestGlobalLetStatements(t *testing.T) {
 		{"let one = 1; one", 1},
 		{"let one = 1; let two = 2; one + two", 3},
 		{"let one = 1; let two = one + one; one + two", 3},
+		{"let one: int = 1; let add = fn(a: int, b) -> int { a + b }; add(one, 2)", 3},
 	}
 
 	runVmTests(t, tests)
@@ -102,6 +116,13 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "yolo"`, "monkeyyolo"},
+		{`"say \"hi\"\n"`, "say \"hi\"\n"},
+		{"`multi\nline ${raw}`", "multi\nline ${raw}"},
+		{`let a = 1; let b = 2; "total: ${a + b}"`, "total: 3"},
+		{`"${[1, "two"]} and ${{"k": true}}"`, "[1, two] and {k: true}"},
+		{`let name = "monkey"; "hi ${upper(name)}!"`, "hi MONKEY!"},
+		{`"${"nested ${1 + 1}"}"`, "nested 2"},
+		{`fn(x) { "x=${x}" }(5)`, "x=5"},
 	}
 	runVmTests(t, tests)
 }
@@ -145,15 +166,350 @@ func TestIndexExpressions(t *testing.T) {
 		{"[[1, 1, 1]][0][0]", 1},
 		{"[][0]", Null},
 		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
+		{"[1][-1]", 1},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", Null},
+		{`"abc"[-1]`, "c"},
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{`"héllo"[1]`, "é"},
+		{`"世界"[1]`, "界"},
+		{`"abc"[3]`, Null},
 	}
 	runVmTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][2:99]", []int{3, 4}},
+		{"let a = [1, 2]; let b = a[:]; a == b", true},
+		{`"héllo"[1:3]`, "él"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[:0]`, ""},
+	}
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; [a, b, rest[0], rest[1], len(rest)]", []int{1, 2, 3, 4, 2}},
+		{`let {name, age} = {"name": "ann", "age": 3}; name`, "ann"},
+		{`let {"k": [x, {y}], missing} = {"k": [1, {"y": 2}]}; [x, y]`, []int{1, 2}},
+		{`let {missing} = {}; missing`, Null},
+		{"let [p, q, ...r] = [1]; q", Null},
+		{"let [p, q, ...r] = [1]; r", []int{}},
+		{"let [m, n] = [1, 2]; let [m, n] = [n, m]; [m, n]", []int{2, 1}},
+		{"let swap = fn([a, b]) { [b, a] }; swap([1, 2])", []int{2, 1}},
+		{`let greet = fn({name}, greeting) { greeting + " " + name }; greet({"name": "bo"}, "hi")`, "hi bo"},
+		{"let f = fn(v) { let [h, ...r] = v; fn() { h + len(r) } }; f([5, 6, 7])()", 7},
+		{"let f = fn() { let [a] = [1]; let [b] = [2]; a + b }; f()", 3},
+	}
+	runVmTests(t, tests)
+}
+
+func TestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(a, b = 10) { a + b }; f(1) + f(1, 2)", 14},
+		{"let a = 5; let f = fn(a = 1, b = a) { [a, b] }; f()", []int{1, 5}},
+		{"let n = 1; let f = fn(x = n) { x }; let n = 2; f()", 1},
+		{"let f = fn(a, ...rest) { rest }; f(1)", []int{}},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1)", []int{1, 2, 0}},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1, 3, 4, 5)", []int{1, 3, 2}},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])", 6},
+		{"let add = fn(a, b, c) { a + b + c }; let xs = [2]; add(1, ...xs, 3)", 6},
+		{"let all = fn(...xs) { xs }; all(...[1], ...[], 2, ...[3])", []int{1, 2, 3}},
+		{"let outer = fn(x) { fn(y = x * 2) { y } }; outer(4)()", 8},
+		{"map([1, 2], fn(x, scale = 10) { x * scale })", []int{10, 20}},
+		{"let f = fn([a, b] = [1, 2]) { a + b }; f()", 3},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	point := `struct Point {
+  x,
+  y,
+  fn norm(p) { p.x * p.x + p.y * p.y },
+  fn add(p, q) { Point(p.x + q.x, p.y + q.y) },
+}
+`
+	tests := []vmTestCase{
+		{point + "Point(1, 2).x", 1},
+		{point + "let p = Point(3, 4); [p.x, p.y, p.norm()]", []int{3, 4, 25}},
+		{point + "Point(1, 2).add(Point(3, 4)).y", 6},
+		{point + "let n = Point(1, 1).norm; n()", 2},
+		{point + "Point(1, 2) == Point(1, 2)", true},
+		{point + "struct Other { x, y } Point(1, 2) == Other(1, 2)", false},
+		{point + "type(Point(1, 2))", "Point"},
+		{point + "type(Point(1, 2).norm)", "FUNCTION"},
+		{point + "map([Point(1, 2), Point(3, 4)], fn(p) { p.x })", []int{1, 3}},
+		{point + "let p = Point(1, 1); map(map([Point(1, 2), Point(3, 4)], p.add), fn(q) { q.y })", []int{3, 5}},
+		{"struct Box { v } map(map([1, 2], Box), fn(b) { b.v * 10 })", []int{10, 20}},
+		{"let f = fn() { struct Local { v } Local(1).v }; f()", 1},
+		{"let f = fn(k) { struct Scaled { v, fn get(s) { s.v * k } } Scaled(2) }; f(3).get()", 6},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStructErrors(t *testing.T) {
+	point := `struct Point {
+  x,
+  y,
+  fn norm(p) { p.x * p.x + p.y * p.y },
+  fn add(p, q) { Point(p.x + q.x, p.y + q.y) },
+}
+`
+	tests := []vmTestCase{
+		{point + "Point(1)", "wrong number of arguments: want=2, got=1"},
+		{point + "Point(1, 2).z", "Point has no field or method z"},
+		{"1.x", "field access not supported: INTEGER"},
+		{"struct P { fn m(p, a) { a } } P().m()", "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	pairs := "let pairs = fn(xs) { let g = fn() { for (k, v in xs) { yield [k, v]; } }; map(g(), fn(p) { p }) };\n"
+	tests := []vmTestCase{
+		{pairs + "last(pairs([1, 2, 3]))", []int{2, 3}},
+		{pairs + `last(pairs("héllo"))[1]`, "o"},
+		{pairs + `last(pairs({"a": 1, "b": 2}))[0]`, "b"},
+		{"let f = fn() { for (x in []) { return 1; } 0 }; f()", 0},
+		{"let f = fn(h) { for (k in h) { if (k == 2) { return k; } } -1 }; f({1: true, 2: false})", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } } }; f(range(0, 10))", 3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } } }; f([1])", Null},
+		{"let f = fn() { for (i in range(3)) { for (j in range(3)) { if (i * j == 2) { return [i, j]; } } } }; f()", []int{1, 2}},
+		{"let r = if (true) { for (x in []) {} }; r", Null},
+		{"let l = 0; for (x in [1, 2]) { let l = x; } l", 0},
+		{"let x = 9; for (x in [1, 2]) { x }; x", 9},
+		{"let f = fn() { let x = 9; for (x in [1, 2]) { x }; x }; f()", 9},
+		{"let f = fn() { let fs = map([1, 2], fn(x) { x }); for (x in fs) { let fs = 0; } fs }; f()", []int{1, 2}},
+		{"for (x in [1]) { x }", Null},
+	}
+	runVmTests(t, tests)
+}
+
+func TestForLoopErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"for (x in 1) {}", "cannot iterate over INTEGER"},
+		{"let f = fn(h) { for (k, v in h) { v } }; f(true)", "cannot iterate over BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	gen := "let gen = fn() { yield 1; yield 2; };\n"
+	tests := []vmTestCase{
+		{gen + "let g = gen(); [g.next(), g.next()]", []int{1, 2}},
+		{gen + "let g = gen(); g.next(); g.next(); g.next()", Null},
+		{gen + "let pairs = fn(g) { let p = fn() { for (i, x in g) { yield [i, x]; } }; map(p(), fn(x) { x }) }; last(pairs(gen()))", []int{1, 2}},
+		{"let count = fn(from) { for (i in range(100)) { yield from + i; } }; let c = count(10); c.next(); c.next()", 11},
+		{"let nat = fn() { let f = fn(n) { yield n; for (x in f(n + 1)) { yield x; } }; f(0) }; any(nat(), fn(x) { x > 5 })", true},
+		{gen + "map(gen(), fn(x) { x * 10 })", []int{10, 20}},
+		{gen + "reduce(gen(), fn(a, b) { a + b })", 3},
+		{gen + `join(gen(), "-")`, "1-2"},
+		{"let g = fn() { yield 1; return 5; yield 2; }; map(g(), fn(x) { x })", []int{1}},
+		{"let tree = fn(n) { if (n > 0) { for (x in tree(n - 1)) { yield x; } yield n; for (x in tree(n - 1)) { yield x; } } }; join(tree(3), \",\")", "1,2,1,3,1,2,1"},
+		{"struct R { n, fn each(r) { for (i in range(r.n)) { yield i; } } } map(R(3).each(), fn(x) { x })", []int{0, 1, 2}},
+		{gen + "type(gen())", "GENERATOR"},
+		{gen + "sort(gen(), fn(a, b) { a > b })", []int{2, 1}},
+		{gen + "reverse(gen())", []int{2, 1}},
+		{"let nat = fn() { let f = fn(n) { yield n; for (x in f(n + 1)) { yield x; } }; f(0) };\nlet z = zip(nat(), [5, 6]); [z[0][0], z[0][1], z[1][0], z[1][1], len(z)]", []int{0, 5, 1, 6, 2}},
+		{"let nat = fn() { let f = fn(n) { yield n; for (x in f(n + 1)) { yield x; } }; f(0) };\nlet [a, b] = nat(); [a, b]", []int{0, 1}},
+		{gen + "let [a, ...r] = gen(); r", []int{2}},
+		{gen + "let f = fn([a, b, c]) { c }; f(gen())", Null},
+		{"sort(1)", &object.Error{Message: "argument to `sort` must be ARRAY or GENERATOR, got INTEGER"}},
+		{"zip([1], 2)", &object.Error{Message: "argument to `zip` must be ARRAY or GENERATOR, got INTEGER"}},
+		{"let bad = fn() { yield 1; 1 + true; }; let b = bad(); b.next(); b.next()", &object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"let bad = fn() { yield 1; 1 + true; }; for (x in bad()) { x }", "unsupported types for binary operation: INTEGER BOOLEAN"},
+		{"let gen = fn() { yield 1; }; gen().x", "GENERATOR has no field or method x"},
+		{"let bad = fn() { yield 1; 1 + true; }; let [a, b] = bad();", "unsupported types for binary operation: INTEGER BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a] = 1;", "cannot destructure INTEGER as ARRAY"},
+		{"let f = fn({a}) { a }; f([1])", "cannot destructure ARRAY as HASH"},
+		{"let [{a}] = [[1]];", "cannot destructure ARRAY as HASH"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	describe := `let describe = fn(v) {
+  match (v) {
+    0 => "zero",
+    -1 => "minus one",
+    "hi" => "greeting",
+    true => "yes",
+    [] => "empty",
+    [x] => "one ${x}",
+    [x, y, ...more] if x > y => "desc ${len(more)}",
+    [_, ...more] => "many ${len(more)}",
+    {"name": name, "age": a} => "${name} ${a}",
+    {} => "hash",
+    n if n > 100 => "big",
+    _ => "other",
+  }
+};
+`
+	tests := []vmTestCase{
+		{describe + "describe(0)", "zero"},
+		{describe + "describe(-1)", "minus one"},
+		{describe + `describe("hi")`, "greeting"},
+		{describe + "describe(true)", "yes"},
+		{describe + "describe([])", "empty"},
+		{describe + "describe([7])", "one 7"},
+		{describe + "describe([3, 2, 1, 0])", "desc 2"},
+		{describe + "describe([1, 2, 3])", "many 2"},
+		{describe + `describe({"name": "ann", "age": 3})`, "ann 3"},
+		{describe + `describe({"name": "ann"})`, "hash"},
+		{describe + "describe(101)", "big"},
+		{describe + "describe(5)", "other"},
+		{"match (5) { 1 => 2 }", Null},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c, _ => 0 }", 6},
+		{"match ([1, 2]) { [a, ...r] => r }", []int{2}},
+		{`match ({"a": {"b": 2}}) { {"a": {"b": b}} => b }`, 2},
+		{"match (1) { x => match (x + 1) { y => x + y } }", 3},
+		{"let x = 1; match (2) { x if x > 5 => 0, _ => x }", 1},
+		{"let x = 9; match (1) { x => x }; x", 9},
+		{"let f = fn() { let x = 9; match (1) { x => x } + x }; f()", 10},
+		{"let f = fn(v) { match (v) { [a, ...r] => a + len(r) } }; f([5, 0, 0])", 7},
+		{"let f = fn(v) { fn() { match (v) { [a] => a } } }; f([9])()", 9},
+		{"let f = fn(v) { fn() { match (v) { [a] => fn() { a } } } }; f([9])()()", 9},
+	}
+	runVmTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { match (5) { [a] => a, _ => a } }; f()", "undefined variable a"},
+		{"match ([1, 2]) { [a, 3] => 0, _ => a }", "undefined variable a"},
+		{"match ([1, 2]) { [a, ...r] => 0 }; r", "undefined variable r"},
+		{"match (1) { x => x }; x", "undefined variable x"},
+		{"let f = fn() { for (x in []) { }; x }; f()", "undefined variable x"},
+		{"for (k, v in [1]) { }; k", "undefined variable k"},
+		{"let f = fn(xs) { for (x in xs) { let y = x * 10; } y }; f([1])", "undefined variable y"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		err := compiler.New().Compile(program)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compiler error for %s: want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestSliceErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"1[1:]", "slice operator not supported: INTEGER"},
+		{`[1]["a":]`, "slice bound must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -375,6 +731,22 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 			input:    `fn(a, b) { a + b; }(1);`,
 			expected: `wrong number of arguments: want=2, got=1`,
 		},
+		{
+			input:    `fn(a, b = 1) { a + b; }(1, 2, 3);`,
+			expected: `wrong number of arguments: want=1 to 2, got=3`,
+		},
+		{
+			input:    `fn(a, ...rest) { a; }();`,
+			expected: `wrong number of arguments: want=1 or more, got=0`,
+		},
+		{
+			input:    `fn(a, b) { a + b; }(...[1, 2, 3]);`,
+			expected: `wrong number of arguments: want=2, got=3`,
+		},
+		{
+			input:    `fn(a) { a; }(..."ab");`,
+			expected: `cannot spread STRING`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -404,6 +776,9 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("世界")`, 2},
+		{`bytes("hé")`, []int{104, 195, 169}},
 		{
 			`len(1)`,
 			&object.Error{Message: "argument to `len` not supported, got INTEGER"},
@@ -438,6 +813,172 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,c", ",")`, []string{"a", "b", "c"}},
+		{`split("abc", "")`, []string{"a", "b", "c"}},
+		{`join(["a", "b", 1], "-")`, "a-b-1"},
+		{`join([], "-")`, ""},
+		{`trim("  hi there ")`, "hi there"},
+		{`upper("MonKey")`, "MONKEY"},
+		{`lower("MonKey")`, "monkey"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "donkey")`, false},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`index_of("monkey", "key")`, 3},
+		{`index_of("monkey", "x")`, -1},
+		{`substr("monkey", 3)`, "key"},
+		{`substr("monkey", 1, 3)`, "on"},
+		{`substr("monkey", 4, 99)`, "ey"},
+		{`starts_with("monkey", "mon")`, true},
+		{`ends_with("monkey", "mon")`, false},
+		{`repeat("ab", 3)`, "ababab"},
+		{`chars("abc")`, []string{"a", "b", "c"}},
+		{`format("{} + {} = {}", 1, 2, "three")`, "1 + 2 = three"},
+		{`format("no values")`, "no values"},
+		{
+			`split("a", 1)`,
+			&object.Error{Message: "argument to `split` must be STRING, got INTEGER"},
+		},
+		{
+			`upper()`,
+			&object.Error{Message: "wrong number of arguments. got=0, want=1"},
+		},
+		{
+			`repeat("a", -1)`,
+			&object.Error{Message: "negative repeat count: -1"},
+		},
+		{
+			`format("{} {}", 1)`,
+			&object.Error{Message: "wrong number of values for format string. got=1, want=2"},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, []int{11, 12}},
+		{`map(["a", "b"], upper)`, []string{"A", "B"}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 10)`, 20},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc * x })`, 24},
+		{`reduce([], fn(acc, x) { acc + x })`, Null},
+		{`flat_map([1, 2], fn(x) { [x, x * 10] })`, []int{1, 10, 2, 20}},
+		{`let g = fn(n) { yield n; yield -n; }; flat_map([1, 2], g)`, []int{1, -1, 2, -2}},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort(["b", "c", "a"])`, []string{"a", "b", "c"}},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`let arr = [2, 1]; sort(arr); arr`, []int{2, 1}},
+		{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+		{`reverse("héllo")`, "olléh"},
+		{`uniq([3, 1, 3, 2, 1])`, []int{3, 1, 2}},
+		{`uniq(["a", "b", "a"])`, []string{"a", "b"}},
+		{`len(uniq([1, "1", [1], [1], {"a": 1}, {"a": 1}, true, 1]))`, 5},
+		{`range(3)`, []int{0, 1, 2}},
+		{`range(2, 5)`, []int{2, 3, 4}},
+		{`range(5, 0, -2)`, []int{5, 3, 1}},
+		{`len(zip([1, 2, 3], ["a", "b"]))`, 2},
+		{`zip([1, 2], [3, 4])[1]`, []int{2, 4}},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, true},
+		{`any([], fn(x) { true })`, false},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, true},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, false},
+		{
+			`let double = fn(arr) { map(arr, fn(x) { x * 2 }) };
+			map([[1], [2, 3]], fn(a) { reduce(double(a), fn(acc, x) { acc + x }, 0) })`,
+			[]int{2, 10},
+		},
+		{
+			`map([1], fn(x) { x + true })`,
+			&object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"},
+		},
+		{
+			`map([1], fn(a, b) { a })`,
+			&object.Error{Message: "wrong number of arguments: want=2, got=1"},
+		},
+		{
+			`map([1], 1)`,
+			&object.Error{Message: "argument to `map` must be a function, got INTEGER"},
+		},
+		{
+			`sort([1, "a"])`,
+			&object.Error{Message: "cannot compare STRING and INTEGER, pass `sort` a comparator"},
+		},
+		{
+			`range(0, 1, 0)`,
+			&object.Error{Message: "`range` step must not be 0"},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`keys({"b": 1, "a": 2})`, []string{"b", "a"}},
+		{`values({"b": 1, "a": 2})`, []int{1, 2}},
+		{`keys({})`, []int{}},
+		{`has({"a": if (false) { 1 }}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`let h = {"a": 1, "b": 2}; keys(delete(h, "a"))`, []string{"b"}},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); len(h)`, 2},
+		{`let m = merge({"a": 1, "b": 2}, {"b": 3, "c": 4}); values(m)`, []int{1, 3, 4}},
+		{`entries({1: 2, 3: 4})[1]`, []int{3, 4}},
+		{`len({"a": 1, "b": 2})`, 2},
+		{
+			`keys([1])`,
+			&object.Error{Message: "argument to `keys` must be HASH, got ARRAY"},
+		},
+		{
+			`has({}, [1])`,
+			&object.Error{Message: "unusable as hash key: ARRAY"},
+		},
+		{
+			`merge({}, 1)`,
+			&object.Error{Message: "argument to `merge` must be HASH, got INTEGER"},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("[1, 2.5, \"a\", true, null]")`, "[1, 2.5, a, true, null]"},
+		{`json_parse("{\"b\": {\"c\": []}, \"a\": 1}")`, "{b: {c: []}, a: 1}"},
+		{`json_parse("{\"a\": 2.0}")["a"]`, "2.0"},
+		{`json_stringify({"b": [1, "x"], "a": json_parse("null"), 3: true})`, `{"b":[1,"x"],"a":null,"3":true}`},
+		{`json_stringify("<\"q\">\n")`, `"<\"q\">\n"`},
+		{`json_stringify({"a": [1]}, 2)`, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{`json_stringify({}, "\t")`, "{}"},
+		{`let s = "{\"x\":[1,{\"y\":false}],\"w\":1.5}"; json_stringify(json_parse(s)) == s`, "true"},
+		{`json_parse("[1,")`, "ERROR: invalid JSON: unexpected end of JSON input"},
+		{`json_parse("1 2")`, "ERROR: invalid JSON: unexpected data after top-level value"},
+		{`json_stringify([fn() {}])`, "ERROR: cannot encode CLOSURE as JSON"},
+		{`json_stringify(len)`, "ERROR: cannot encode BUILTIN as JSON"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -670,6 +1211,20 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 			}
 		}
 
+	case []string:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElem := range expected {
+			testExpectedObject(t, expectedElem, array.Elements[i])
+		}
+
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
@@ -717,3 +1272,163 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestUnsetGlobal(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: code.Make(code.OpGetGlobal, 1),
+		GlobalNames:  []string{"a", "b"},
+	}
+
+	vm := New(bytecode)
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	expected := "variable b used before being set"
+	if err.Error() != expected {
+		t.Fatalf("wrong VM error: want=%q, got=%q", expected, err)
+	}
+
+	// the second x gets a slot of its own, unset while its value is computed
+	program := parser.New(lexer.New("let x = 1; let x = x + 1;")).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "variable x used before being set" {
+		t.Fatalf("wrong VM error: want=%q, got=%v", "variable x used before being set", err)
+	}
+}
+
+func TestHashInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, "{}"},
+		{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+		{`{3: [1, 2], 1: {true: false}}`, "{3: [1, 2], 1: {true: false}}"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect() output. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+
+	tests := []struct {
+		input          string
+		stdin          string
+		allowFS        bool
+		expected       string
+		expectedStdout string
+		expectedStderr string
+	}{
+		{`puts(1, "a"); print("b", [2]); print("!")`, "", false, "null", "1\na\nb [2]!", ""},
+		{`eprint("oops\n")`, "", false, "null", "", "oops\n"},
+		{`[read_line(), read_line(), read_line()]`, "first\r\nsecond", false, "[first, second, null]", "", ""},
+		{`read_line(1)`, "", false, "ERROR: wrong number of arguments. got=1, want=0", "", ""},
+		{fmt.Sprintf(`read_file(%q)`, path), "", false, "ERROR: file system access is not allowed", "", ""},
+		{fmt.Sprintf(`write_file(%q, "x")`, path), "", false, "ERROR: file system access is not allowed", "", ""},
+		{fmt.Sprintf(`write_file(%q, "héllo"); read_file(%q)`, path, path), "", true, "héllo", "", ""},
+		{`read_file("/does/not/exist")`, "", true, "ERROR: open /does/not/exist: no such file or directory", "", ""},
+		{`write_file("a.txt", 1)`, "", true, "ERROR: argument to `write_file` must be STRING, got INTEGER", "", ""},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		host := object.NewHost(strings.NewReader(tt.stdin), &stdout, &stderr)
+		host.AllowFileSystem = tt.allowFS
+
+		vm := New(comp.Bytecode())
+		vm.SetHost(host)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("wrong stdout for %s. want=%q, got=%q", tt.input, tt.expectedStdout, stdout.String())
+		}
+		if stderr.String() != tt.expectedStderr {
+			t.Errorf("wrong stderr for %s. want=%q, got=%q", tt.input, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/counter.mk": `let base = import("base.mk"); puts("loaded"); let next = fn(x) { x + base["step"] };`,
+		"lib/base.mk":    `let step = 10;`,
+		"lib/shapes.mk":  `struct P { x, fn get(p) { p.x } }`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input          string
+		expected       string
+		expectedStdout string
+	}{
+		{`let step = 1; let c = import("lib/counter.mk"); c["next"](step)`, "11", "loaded\n"},
+		{`keys(import("lib/counter.mk"))`, "[base, next]", "loaded\n"},
+		{`let get = fn() { import("lib/counter.mk") }; get()["next"](get()["base"]["step"])`, "20", "loaded\n"},
+		{`let f = fn() { import("lib/counter.mk") }; 1`, "1", ""},
+		{`let s = import("lib/shapes.mk"); s["P"](4).get()`, "4", ""},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.NewForFile(filepath.Join(dir, "main.mk"))
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		var stdout bytes.Buffer
+		vm := New(comp.Bytecode())
+		vm.SetHost(object.NewHost(strings.NewReader(""), &stdout, &stdout))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("wrong stdout for %s. want=%q, got=%q", tt.input, tt.expectedStdout, stdout.String())
+		}
+	}
+}